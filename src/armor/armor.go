@@ -0,0 +1,389 @@
+// Package armor implements PEM-like envelopes around base64 data, with
+// optional key/value headers and an OpenPGP-style CRC24 checksum:
+//
+//	-----BEGIN TYPE-----
+//	Key: Value
+//
+//	<base64 lines>
+//	=<base64 checksum>
+//	-----END TYPE-----
+//
+// The blank line is only present if there are headers.
+package armor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	b64 "github.com/illikainen/go-utils/src/base64"
+	"github.com/illikainen/go-utils/src/stringx"
+
+	"github.com/pkg/errors"
+)
+
+// LineWidth is the width of the base64 lines written by Encode().
+const LineWidth = 64
+
+// MaxLineLength is the longest line that's accepted by a Reader.
+const MaxLineLength = 64 << 10
+
+const (
+	beginPrefix = "-----BEGIN "
+	endPrefix   = "-----END "
+	suffix      = "-----"
+)
+
+var ErrChecksum = errors.New("armor: checksum mismatch")
+
+// Block is a decoded armored block.
+type Block struct {
+	Type    string
+	Headers map[string]string
+	Body    []byte
+}
+
+// Encode writes an armored block to w.  Headers are written in sorted order.
+// Header values are sanitized with stringx.Sanitize(), but values with line
+// breaks are rejected.
+func Encode(w io.Writer, typ string, headers map[string]string, body io.Reader) error {
+	if !validType(typ) {
+		return errors.Errorf("armor: invalid type: %q", typ)
+	}
+
+	keys := make([]string, 0, len(headers))
+	for key, value := range headers {
+		if !validKey(key) {
+			return errors.Errorf("armor: invalid header: %q", key)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return errors.Errorf("armor: invalid value for header %s", key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	bw := bufio.NewWriter(w)
+	_, err := fmt.Fprintf(bw, "%s%s%s\n", beginPrefix, typ, suffix)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		_, err := fmt.Fprintf(bw, "%s: %s\n", key, stringx.Sanitize(headers[key]))
+		if err != nil {
+			return err
+		}
+	}
+	if len(keys) > 0 {
+		_, err := bw.WriteString("\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	crc := newCRC24()
+	enc := b64.NewEncoder(base64.StdEncoding, bw, LineWidth)
+	_, err = io.Copy(io.MultiWriter(enc, crc), body)
+	if err != nil {
+		return err
+	}
+
+	err = enc.Close()
+	if err != nil {
+		return err
+	}
+
+	checksum := base64.StdEncoding.EncodeToString(crc.bytes())
+	_, err = fmt.Fprintf(bw, "=%s\n%s%s%s\n", checksum, endPrefix, typ, suffix)
+	if err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// Decode reads every block in r with a lenient Reader.
+func Decode(r io.Reader) ([]*Block, error) {
+	reader := NewReader(r)
+
+	var blocks []*Block
+	for {
+		block, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return blocks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+}
+
+// Reader reads a stream of armored blocks.
+//
+// By default, the parsing is lenient: text between blocks is ignored,
+// whitespace and CRLF line endings are accepted, the checksum is optional,
+// and invalid characters in headers are replaced with stringx.Sanitize().
+//
+// If Strict is set, the input must be in the form written by Encode():
+// nothing but blocks, no extraneous whitespace, a checksum in every block,
+// unique headers, and no invalid characters in headers.
+type Reader struct {
+	Strict bool
+
+	scanner *bufio.Scanner
+	line    int
+}
+
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), MaxLineLength)
+	scanner.Split(scanLines)
+	return &Reader{scanner: scanner}
+}
+
+// Next returns the next block, or io.EOF if there are no more blocks.
+func (r *Reader) Next() (*Block, error) {
+	typ, err := r.begin()
+	if err != nil {
+		return nil, err
+	}
+
+	block := &Block{Type: typ, Headers: map[string]string{}}
+	line, err := r.headers(block)
+	if err != nil {
+		return nil, err
+	}
+
+	crc := newCRC24()
+	encoded := &bytes.Buffer{}
+	start := r.line
+	checksum := ""
+
+	for {
+		switch {
+		case strings.HasPrefix(line, endPrefix):
+			if line != endPrefix+typ+suffix {
+				return nil, r.errorf("mismatched end: %q", line)
+			}
+
+			block.Body, err = r.decode(encoded.Bytes(), start)
+			if err != nil {
+				return nil, err
+			}
+			_, _ = crc.Write(block.Body)
+
+			if checksum == "" && r.Strict {
+				return nil, r.errorf("missing checksum")
+			}
+			if checksum != "" && checksum != base64.StdEncoding.EncodeToString(crc.bytes()) {
+				return nil, errors.Wrapf(ErrChecksum, "line %d", r.line)
+			}
+			return block, nil
+		case checksum != "":
+			return nil, r.errorf("expected end of %s", typ)
+		case strings.HasPrefix(line, "=") && len(line) == 5:
+			checksum = line[1:]
+		case r.Strict && (len(line) > LineWidth || strings.ContainsAny(line, " \t")):
+			return nil, r.errorf("invalid line")
+		default:
+			encoded.WriteString(line + "\n")
+		}
+
+		line, err = r.next()
+		if err != nil {
+			return nil, r.unexpected(err)
+		}
+	}
+}
+
+// begin skips to the start of the next block and returns its type.
+func (r *Reader) begin() (string, error) {
+	for {
+		line, err := r.next()
+		if err != nil {
+			return "", err
+		}
+
+		if strings.HasPrefix(line, beginPrefix) && strings.HasSuffix(line, suffix) {
+			typ := line[len(beginPrefix) : len(line)-len(suffix)]
+			if !validType(typ) {
+				return "", r.errorf("invalid type: %q", stringx.Sanitize(typ))
+			}
+			return typ, nil
+		}
+
+		if r.Strict {
+			return "", r.errorf("unexpected data outside of block")
+		}
+	}
+}
+
+// headers reads the headers of a block and returns the first line after
+// them.
+func (r *Reader) headers(block *Block) (string, error) {
+	line, err := r.next()
+	if err != nil {
+		return "", r.unexpected(err)
+	}
+
+	if line == "" && !r.Strict {
+		// OpenPGP-style blocks have a blank line even without headers.
+		line, err = r.next()
+		if err != nil {
+			return "", r.unexpected(err)
+		}
+		return line, nil
+	}
+
+	for strings.Contains(line, ":") {
+		key, value, err := r.header(line)
+		if err != nil {
+			return "", err
+		}
+
+		if _, ok := block.Headers[key]; ok && r.Strict {
+			return "", r.errorf("duplicate header: %s", key)
+		}
+		block.Headers[key] = value
+
+		line, err = r.next()
+		if err != nil {
+			return "", r.unexpected(err)
+		}
+
+		if line == "" {
+			line, err = r.next()
+			if err != nil {
+				return "", r.unexpected(err)
+			}
+			return line, nil
+		}
+	}
+
+	if len(block.Headers) > 0 && r.Strict {
+		return "", r.errorf("missing blank line after headers")
+	}
+	return line, nil
+}
+
+func (r *Reader) header(line string) (string, string, error) {
+	idx := strings.Index(line, ":")
+	key := line[:idx]
+	value := line[idx+1:]
+
+	if r.Strict {
+		if !validKey(key) || !strings.HasPrefix(value, " ") {
+			return "", "", r.errorf("invalid header")
+		}
+
+		value, err := stringx.StrictPolicy.SanitizeString(value[1:])
+		if err != nil {
+			return "", "", errors.Wrapf(err, "armor: line %d: %s", r.line, key)
+		}
+		return key, value, nil
+	}
+
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return "", "", r.errorf("invalid header")
+	}
+	return stringx.Sanitize(key), stringx.Sanitize(strings.TrimSpace(value)), nil
+}
+
+// decode decodes the body that starts at the given line.
+func (r *Reader) decode(encoded []byte, start int) ([]byte, error) {
+	dec := b64.NewDecoder(base64.StdEncoding, bytes.NewReader(encoded))
+	if !r.Strict {
+		dec.Whitespace = " \t\r\n"
+	}
+
+	body, err := io.ReadAll(dec)
+	if err != nil {
+		var corrupt b64.CorruptInputError
+		if errors.As(err, &corrupt) {
+			line := start + bytes.Count(encoded[:corrupt], []byte("\n"))
+			return nil, errors.Errorf("armor: line %d: invalid base64 data", line)
+		}
+		return nil, err
+	}
+	return body, nil
+}
+
+func (r *Reader) next() (string, error) {
+	if !r.scanner.Scan() {
+		err := r.scanner.Err()
+		if err != nil {
+			return "", errors.Wrapf(err, "armor: line %d", r.line+1)
+		}
+		return "", io.EOF
+	}
+	r.line++
+
+	line := r.scanner.Text()
+	if r.Strict {
+		if strings.HasSuffix(line, "\r") {
+			return "", r.errorf("invalid line ending")
+		}
+		return line, nil
+	}
+	return strings.TrimSpace(line), nil
+}
+
+func (r *Reader) unexpected(err error) error {
+	if errors.Is(err, io.EOF) {
+		return r.errorf("unexpected end of input")
+	}
+	return err
+}
+
+func (r *Reader) errorf(format string, args ...any) error {
+	return errors.Errorf("armor: line %d: %s", r.line, fmt.Sprintf(format, args...))
+}
+
+// scanLines is like bufio.ScanLines, but carriage returns are retained so
+// that they can be rejected in strict mode.
+func scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// validType accepts printable ASCII characters except hyphens, with single
+// spaces between words.
+func validType(typ string) bool {
+	if typ == "" || strings.HasPrefix(typ, " ") || strings.HasSuffix(typ, " ") || strings.Contains(typ, "  ") {
+		return false
+	}
+	for _, c := range typ {
+		if c < 0x20 || c > 0x7e || c == '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// validKey accepts printable ASCII characters except colons and spaces.
+func validKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, c := range key {
+		if c <= 0x20 || c > 0x7e || c == ':' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,116 @@
+package armor_test
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/illikainen/go-utils/src/armor"
+	"github.com/illikainen/go-utils/src/test"
+
+	"github.com/pkg/errors"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	rng := rand.New(rand.NewSource(1)) // #nosec G404
+	data := make([]byte, 1000)
+	_, _ = rng.Read(data)
+
+	out := &bytes.Buffer{}
+	err := armor.Encode(out, "PGP MESSAGE", map[string]string{"Version": "1", "Comment": "a\x1bb"},
+		bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.WriteString("text between blocks\n")
+	err = armor.Encode(out, "CERTIFICATE", nil, strings.NewReader("123456789"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoded := out.String()
+	header := "-----BEGIN PGP MESSAGE-----\nComment: a_b\nVersion: 1\n\n"
+	test.AssertEq(t, strings.HasPrefix(encoded, header), true)
+	test.AssertEq(t, strings.HasSuffix(encoded, "MTIzNDU2Nzg5\n=Ic8C\n-----END CERTIFICATE-----\n"), true)
+
+	blocks, err := armor.Decode(strings.NewReader(encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, len(blocks), 2)
+	test.AssertEq(t, blocks[0].Type, "PGP MESSAGE")
+	test.AssertEq(t, blocks[0].Headers, map[string]string{"Version": "1", "Comment": "a_b"})
+	test.AssertEq(t, bytes.Equal(blocks[0].Body, data), true)
+	test.AssertEq(t, blocks[1].Type, "CERTIFICATE")
+	test.AssertEq(t, blocks[1].Headers, map[string]string{})
+	test.AssertEq(t, string(blocks[1].Body), "123456789")
+
+	r := armor.NewReader(strings.NewReader(encoded))
+	r.Strict = true
+	_, err = r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.Next()
+	test.AssertNe(t, err, nil)
+
+	err = armor.Encode(out, "X", map[string]string{"Key": "a\nb"}, strings.NewReader(""))
+	test.AssertNe(t, err, nil)
+
+	err = armor.Encode(out, "-X-", nil, strings.NewReader(""))
+	test.AssertNe(t, err, nil)
+}
+
+func TestDecodeLenient(t *testing.T) {
+	input := "garbage\r\n" +
+		"-----BEGIN MESSAGE-----\r\n" +
+		" Key : \x1b[31mred\r\n" +
+		"Key: value\r\n" +
+		"\r\n" +
+		"MTIz NDU2\r\n" +
+		"Nzg5  \r\n" +
+		"-----END MESSAGE-----\r\n"
+
+	blocks, err := armor.Decode(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, len(blocks), 1)
+	test.AssertEq(t, blocks[0].Headers, map[string]string{"Key": "value"})
+	test.AssertEq(t, string(blocks[0].Body), "123456789")
+
+	r := armor.NewReader(strings.NewReader(input))
+	r.Strict = true
+	_, err = r.Next()
+	test.AssertNe(t, err, nil)
+
+	input = "-----BEGIN MESSAGE-----\nKey: \x1b[31mred\n\nMTIzNDU2Nzg5\n=Ic8C\n-----END MESSAGE-----\n"
+	blocks, err = armor.Decode(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, blocks[0].Headers["Key"], "_[31mred")
+
+	r = armor.NewReader(strings.NewReader(input))
+	r.Strict = true
+	_, err = r.Next()
+	test.AssertNe(t, err, nil)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for input, msg := range map[string]string{
+		"-----BEGIN A-----\nMTIzNDU2Nzg5\n=AAAA\n-----END A-----\n": "checksum mismatch",
+		"-----BEGIN A-----\nMTIzNDU2Nzg5\n-----END B-----\n":        "line 3: mismatched end",
+		"-----BEGIN A-----\nMTIz\nND*2Nzg5\n-----END A-----\n":      "line 3: invalid base64",
+		"-----BEGIN A-----\nMTIzNDU2Nzg5\n":                         "unexpected end",
+		"-----BEGIN A-----\n=Ic8C\nMTIz\n-----END A-----\n":         "expected end of A",
+	} {
+		_, err := armor.Decode(strings.NewReader(input))
+		test.AssertNe(t, err, nil)
+		test.AssertEq(t, strings.Contains(err.Error(), msg), true)
+	}
+
+	_, err := armor.Decode(strings.NewReader("-----BEGIN A-----\nMTIzNDU2Nzg5\n=AAAA\n-----END A-----\n"))
+	test.AssertEq(t, errors.Is(err, armor.ErrChecksum), true)
+}
@@ -0,0 +1,32 @@
+package armor
+
+// The CRC24 from RFC 4880.
+const (
+	crc24Init = 0xb704ce
+	crc24Poly = 0x1864cfb
+)
+
+type crc24 struct {
+	sum uint32
+}
+
+func newCRC24() *crc24 {
+	return &crc24{sum: crc24Init}
+}
+
+func (c *crc24) Write(p []byte) (int, error) {
+	for _, b := range p {
+		c.sum ^= uint32(b) << 16
+		for i := 0; i < 8; i++ {
+			c.sum <<= 1
+			if c.sum&0x1000000 != 0 {
+				c.sum ^= crc24Poly
+			}
+		}
+	}
+	return len(p), nil
+}
+
+func (c *crc24) bytes() []byte {
+	return []byte{byte(c.sum >> 16), byte(c.sum >> 8), byte(c.sum)}
+}
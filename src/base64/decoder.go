@@ -2,48 +2,337 @@ package base64
 
 import (
 	"encoding/base64"
+	"fmt"
 	"io"
+	"math"
 	"os"
+	"strings"
+	"time"
 
-	"github.com/illikainen/go-utils/src/buffer"
+	"github.com/pkg/errors"
 )
 
+// DefaultWhitespace are the characters that are skipped by default.
+const DefaultWhitespace = "\r\n"
+
+// DefaultCacheSize is the number of decoded bytes that are cached by a
+// SeekableDecoder by default.
+const DefaultCacheSize = 1 << 20
+
+const readSize = 32 << 10
+
+// CorruptInputError is the offset of the first invalid character in the
+// encoded input, including skipped whitespace.
+type CorruptInputError int64
+
+func (e CorruptInputError) Error() string {
+	return fmt.Sprintf("illegal base64 data at input byte %d", int64(e))
+}
+
+// Decoder is a streaming base64 decoder.  Characters in Whitespace are
+// skipped anywhere in the input.
 type Decoder struct {
-	buffer *buffer.Reader
+	Whitespace string
+
+	encoding *base64.Encoding
+	reader   io.Reader
+	raw      []byte
+	encoded  []byte
+	offsets  []int64
+	decoded  []byte
+	offset   int64
+	padded   bool
+	eof      bool
+	err      error
+}
+
+func NewDecoder(enc *base64.Encoding, r io.Reader) *Decoder {
+	return &Decoder{
+		Whitespace: DefaultWhitespace,
+		encoding:   enc,
+		reader:     r,
+		raw:        make([]byte, readSize),
+	}
+}
+
+func (d *Decoder) Read(p []byte) (int, error) {
+	for len(d.decoded) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.err = d.fill()
+	}
+
+	n := copy(p, d.decoded)
+	d.decoded = d.decoded[n:]
+	return n, nil
 }
 
-func NewDecoder(enc *base64.Encoding, r io.ReadSeeker) (*Decoder, error) {
-	data, err := io.ReadAll(r)
+// fill reads and decodes the next chunk of input.  An incomplete quantum is
+// kept until more input arrives.
+func (d *Decoder) fill() error {
+	if d.eof {
+		return io.EOF
+	}
+
+	n, err := d.reader.Read(d.raw)
+	for i, b := range d.raw[:n] {
+		if strings.IndexByte(d.Whitespace, b) >= 0 {
+			continue
+		}
+
+		offset := d.offset + int64(i)
+		if d.padded {
+			return CorruptInputError(offset)
+		}
+
+		d.encoded = append(d.encoded, b)
+		d.offsets = append(d.offsets, offset)
+	}
+	d.offset += int64(n)
+
+	if errors.Is(err, io.EOF) {
+		d.eof = true
+		return d.decode(len(d.encoded))
+	}
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	decoded, err := enc.DecodeString(string(data))
+	return d.decode(len(d.encoded) - len(d.encoded)%4)
+}
+
+// decode decodes the first n characters of the pending input.
+func (d *Decoder) decode(n int) error {
+	if n == 0 {
+		return nil
+	}
+
+	buf := make([]byte, d.encoding.DecodedLen(n))
+	m, err := d.encoding.Decode(buf, d.encoded[:n])
+	if err != nil {
+		var corrupt base64.CorruptInputError
+		if errors.As(err, &corrupt) {
+			if int(corrupt) < n {
+				return CorruptInputError(d.offsets[corrupt])
+			}
+			return CorruptInputError(d.offsets[n-1] + 1)
+		}
+		return errors.WithStack(err)
+	}
+
+	d.padded = d.encoded[n-1] == '='
+	d.decoded = buf[:m]
+	d.encoded = append(d.encoded[:0], d.encoded[n:]...)
+	d.offsets = append(d.offsets[:0], d.offsets[n:]...)
+	return nil
+}
+
+// SeekableDecoder is a decoder for seekable input.  The most recently decoded
+// bytes are cached, so short seeks are cheap.  Seeking before the cache
+// restarts the decoding from the beginning of the input, and the size is
+// determined by decoding the input in its entirety.
+type SeekableDecoder struct {
+	Whitespace string
+
+	encoding   *base64.Encoding
+	source     io.ReadSeeker
+	start      int64
+	decoder    *Decoder
+	cache      []byte
+	cacheStart int64
+	cacheSize  int
+	position   int64
+	size       int64
+}
+
+// NewSeekableDecoder creates a decoder for the input from the current position
+// of r.  At most cacheSize bytes are cached, or DefaultCacheSize if it's zero.
+func NewSeekableDecoder(enc *base64.Encoding, r io.ReadSeeker, cacheSize int) (*SeekableDecoder, error) {
+	start, err := r.Seek(0, io.SeekCurrent)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Decoder{
-		buffer: buffer.NewReader(decoded),
-	}, nil
+	if cacheSize <= 0 {
+		cacheSize = DefaultCacheSize
+	}
+
+	d := &SeekableDecoder{
+		Whitespace: DefaultWhitespace,
+		encoding:   enc,
+		source:     r,
+		start:      start,
+		cacheSize:  cacheSize,
+		size:       -1,
+	}
+	d.decoder = NewDecoder(enc, r)
+	return d, nil
 }
 
-func (d *Decoder) Read(p []byte) (int, error) {
-	return d.buffer.Read(p)
+func (d *SeekableDecoder) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	err := d.rewind()
+	if err != nil {
+		return 0, err
+	}
+
+	for d.position >= d.cacheEnd() {
+		err := d.fill(len(p))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, d.cache[d.position-d.cacheStart:])
+	d.position += int64(n)
+	return n, nil
 }
 
-func (d *Decoder) Seek(offset int64, whence int) (int64, error) {
-	return d.buffer.Seek(offset, whence)
+// rewind restarts the decoding if the position is before the cache.
+func (d *SeekableDecoder) rewind() error {
+	if d.position >= d.cacheStart {
+		return nil
+	}
+
+	_, err := d.source.Seek(d.start, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	d.decoder = NewDecoder(d.encoding, d.source)
+	d.cache = d.cache[:0]
+	d.cacheStart = 0
+	return nil
+}
+
+// fill decodes more input into the cache and evicts the oldest bytes if the
+// cache is full.
+func (d *SeekableDecoder) fill(size int) error {
+	if size < readSize {
+		size = readSize
+	}
+
+	buf := make([]byte, size)
+	d.decoder.Whitespace = d.Whitespace
+	n, err := d.decoder.Read(buf)
+	if errors.Is(err, io.EOF) {
+		d.size = d.cacheEnd()
+	}
+	if err != nil {
+		return err
+	}
+
+	d.cache = append(d.cache, buf[:n]...)
+	if len(d.cache) > d.cacheSize {
+		// Bytes that haven't been read yet are kept even if the cache
+		// grows beyond its size.
+		evict := len(d.cache) - d.cacheSize
+		if limit := int(d.position - d.cacheStart); evict > limit {
+			evict = limit
+		}
+		d.cache = append(d.cache[:0], d.cache[evict:]...)
+		d.cacheStart += int64(evict)
+	}
+
+	return nil
 }
 
-func (d *Decoder) Stat() (os.FileInfo, error) {
-	return d.buffer.Stat()
+func (d *SeekableDecoder) cacheEnd() int64 {
+	return d.cacheStart + int64(len(d.cache))
 }
 
-func (d *Decoder) Sync() error {
-	return d.buffer.Sync()
+func (d *SeekableDecoder) Seek(offset int64, whence int) (int64, error) {
+	var base int64
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		base = d.position
+	case io.SeekEnd:
+		size, err := d.Size()
+		if err != nil {
+			return 0, err
+		}
+		base = size
+	default:
+		return 0, errors.Errorf("invalid whence: %d", whence)
+	}
+
+	if (offset > 0 && base > math.MaxInt64-offset) || base+offset < 0 {
+		return 0, errors.Errorf("invalid offset: %d", offset)
+	}
+
+	d.position = base + offset
+	return d.position, nil
 }
 
-func (d *Decoder) Name() string {
+// Size returns the size of the decoded data.  The input is decoded in its
+// entirety the first time it's called.
+func (d *SeekableDecoder) Size() (int64, error) {
+	if d.size >= 0 {
+		return d.size, nil
+	}
+
+	position := d.position
+	d.position = d.cacheEnd()
+
+	for d.size < 0 {
+		err := d.fill(readSize)
+		if err != nil && !errors.Is(err, io.EOF) {
+			d.position = position
+			return 0, err
+		}
+		d.position = d.cacheEnd()
+	}
+
+	d.position = position
+	return d.size, nil
+}
+
+func (d *SeekableDecoder) Stat() (os.FileInfo, error) {
+	size, err := d.Size()
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{name: d.Name(), size: size}, nil
+}
+
+func (d *SeekableDecoder) Sync() error {
+	return nil
+}
+
+func (d *SeekableDecoder) Name() string {
 	return "base64decoder"
 }
+
+type fileInfo struct {
+	name string
+	size int64
+}
+
+func (fi *fileInfo) Name() string {
+	return fi.name
+}
+
+func (fi *fileInfo) Size() int64 {
+	return fi.size
+}
+
+func (fi *fileInfo) Mode() os.FileMode {
+	return 0
+}
+
+func (fi *fileInfo) ModTime() time.Time {
+	return time.Time{}
+}
+
+func (fi *fileInfo) IsDir() bool {
+	return false
+}
+
+func (fi *fileInfo) Sys() any {
+	return nil
+}
@@ -0,0 +1,141 @@
+package base64_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	b64 "github.com/illikainen/go-utils/src/base64"
+	"github.com/illikainen/go-utils/src/test"
+
+	"github.com/pkg/errors"
+)
+
+func TestDecoder(t *testing.T) {
+	rng := rand.New(rand.NewSource(1)) // #nosec G404
+
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawURLEncoding} {
+		for _, size := range []int{0, 1, 2, 3, 1000, 200000} {
+			data := make([]byte, size)
+			_, _ = rng.Read(data)
+
+			out := &bytes.Buffer{}
+			e := b64.NewEncoder(enc, out, 76)
+			_, err := e.Write(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = e.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			d := b64.NewDecoder(enc, iotest.OneByteReader(out))
+			decoded, err := io.ReadAll(d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.AssertEq(t, bytes.Equal(decoded, data), true)
+		}
+	}
+}
+
+func TestDecoderWhitespace(t *testing.T) {
+	input := " YWJj\r\n\tZGVm Zw== \n"
+
+	d := b64.NewDecoder(base64.StdEncoding, strings.NewReader(input))
+	_, err := io.ReadAll(d)
+	test.AssertEq(t, err, error(b64.CorruptInputError(0)))
+
+	d = b64.NewDecoder(base64.StdEncoding, strings.NewReader(input))
+	d.Whitespace = " \t\r\n"
+	decoded, err := io.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, string(decoded), "abcdefg")
+}
+
+func TestDecoderCorrupt(t *testing.T) {
+	for input, offset := range map[string]int64{
+		"YWJj\nZG*m\n":      7,
+		"YWJj\nZGVm\nZw\n":  10,
+		"YWJj\nZw==\nYWJj":  10,
+		"YW=j\n":            2,
+		"YWJjZGVmZ2hp\n!\n": 13,
+	} {
+		d := b64.NewDecoder(base64.StdEncoding, iotest.HalfReader(strings.NewReader(input)))
+		_, err := io.ReadAll(d)
+
+		var corrupt b64.CorruptInputError
+		test.AssertEq(t, errors.As(err, &corrupt), true)
+		test.AssertEq(t, int64(corrupt), offset)
+	}
+}
+
+func TestSeekableDecoder(t *testing.T) {
+	rng := rand.New(rand.NewSource(1)) // #nosec G404
+	data := make([]byte, 300000)
+	_, _ = rng.Read(data)
+
+	out := &bytes.Buffer{}
+	e := b64.NewEncoder(base64.StdEncoding, out, 64)
+	_, err := e.Write(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = e.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := b64.NewSeekableDecoder(base64.StdEncoding, bytes.NewReader(out.Bytes()), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := d.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, info.Size(), int64(len(data)))
+	test.AssertEq(t, info.Name(), "base64decoder")
+
+	for _, offset := range []int64{0, 299990, 1000, 150000, 149000, 5, 300000} {
+		pos, err := d.Seek(offset, io.SeekStart)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.AssertEq(t, pos, offset)
+
+		buf := make([]byte, 100)
+		n, err := io.ReadFull(d, buf)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			t.Fatal(err)
+		}
+		end := offset + 100
+		if end > int64(len(data)) {
+			end = int64(len(data))
+		}
+		test.AssertEq(t, bytes.Equal(buf[:n], data[offset:end]), true)
+	}
+
+	pos, err := d.Seek(-10, io.SeekEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, pos, int64(len(data)-10))
+
+	rest, err := io.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, bytes.Equal(rest, data[len(data)-10:]), true)
+
+	_, err = d.Seek(-1, io.SeekStart)
+	test.AssertNe(t, err, nil)
+}
@@ -5,48 +5,161 @@ import (
 	"io"
 
 	"github.com/illikainen/go-utils/src/buffer"
-	"github.com/illikainen/go-utils/src/seq"
 
 	"github.com/pkg/errors"
 )
 
+// maxBatch is the approximate number of encoded bytes that are written to
+// the underlying writer at once.
+const maxBatch = 64 << 10
+
+// Encoder is a streaming base64 encoder that splits the output into lines
+// of at most width characters.  Full lines are written as soon as enough
+// input has arrived, and the remainder is written by Close().
 type Encoder struct {
 	encoder *base64.Encoding
-	writer  io.WriteSeeker
+	writer  io.Writer
 	width   int
-	buffer  *buffer.Writer
+	chunk   int
+	pending []byte
+	closed  bool
 }
 
 var StdEncoding = base64.StdEncoding
 
-func NewEncoder(enc *base64.Encoding, w io.WriteSeeker, width int) *Encoder {
+func NewEncoder(enc *base64.Encoding, w io.Writer, width int) *Encoder {
+	chunk := enc.DecodedLen(width)
 	return &Encoder{
 		encoder: enc,
 		writer:  w,
 		width:   width,
-		buffer:  buffer.NewWriter(),
+		chunk:   chunk,
+		pending: make([]byte, 0, chunk),
 	}
 }
 
 func (e *Encoder) Write(p []byte) (int, error) {
-	return e.buffer.Write(p)
-}
+	if e.closed {
+		return 0, errors.Errorf("write to closed encoder")
+	}
 
-func (e *Encoder) Seek(offset int64, whence int) (int64, error) {
-	return e.buffer.Seek(offset, whence)
+	if e.chunk <= 0 {
+		return 0, errors.Errorf("invalid width: %d", e.width)
+	}
+
+	n := len(p)
+
+	if len(e.pending) > 0 {
+		add := e.chunk - len(e.pending)
+		if add > len(p) {
+			add = len(p)
+		}
+
+		e.pending = append(e.pending, p[:add]...)
+		p = p[add:]
+
+		if len(e.pending) < e.chunk {
+			return n, nil
+		}
+
+		err := e.writeLines(e.pending)
+		if err != nil {
+			return 0, err
+		}
+		e.pending = e.pending[:0]
+	}
+
+	full := len(p) - len(p)%e.chunk
+	if full > 0 {
+		err := e.writeLines(p[:full])
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	e.pending = append(e.pending, p[full:]...)
+	return n, nil
 }
 
+// Close writes the last line.  The underlying writer isn't closed.
 func (e *Encoder) Close() error {
-	for _, chunk := range seq.Chunk(e.buffer.Bytes(), e.encoder.DecodedLen(e.width)) {
-		data := []byte(e.encoder.EncodeToString(chunk) + "\n")
-		n, err := e.writer.Write(data)
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+
+	if len(e.pending) == 0 {
+		return nil
+	}
+
+	err := e.writeLines(e.pending)
+	e.pending = nil
+	return err
+}
+
+// writeLines encodes data as lines of e.chunk bytes each, except for the last
+// line that may be shorter.
+func (e *Encoder) writeLines(data []byte) error {
+	lines := maxBatch / (e.width + 1)
+	if lines < 1 {
+		lines = 1
+	}
+
+	out := []byte{}
+	for len(data) > 0 {
+		out = out[:0]
+		for i := 0; i < lines && len(data) > 0; i++ {
+			size := e.chunk
+			if size > len(data) {
+				size = len(data)
+			}
+
+			start := len(out)
+			out = append(out, make([]byte, e.encoder.EncodedLen(size))...)
+			e.encoder.Encode(out[start:], data[:size])
+			out = append(out, '\n')
+			data = data[size:]
+		}
+
+		n, err := e.writer.Write(out)
 		if err != nil {
 			return err
 		}
-		if n != len(data) {
+		if n != len(out) {
 			return errors.Errorf("invalid write")
 		}
 	}
 
 	return nil
 }
+
+// SeekableEncoder buffers the input so that it can be modified with Seek()
+// before it's encoded by Close().  Unlike Encoder, memory usage grows with
+// the size of the input, so it should only be used when seeking is required.
+type SeekableEncoder struct {
+	encoder *Encoder
+	buffer  *buffer.Writer
+}
+
+func NewSeekableEncoder(enc *base64.Encoding, w io.Writer, width int) *SeekableEncoder {
+	return &SeekableEncoder{
+		encoder: NewEncoder(enc, w, width),
+		buffer:  buffer.NewWriter(),
+	}
+}
+
+func (e *SeekableEncoder) Write(p []byte) (int, error) {
+	return e.buffer.Write(p)
+}
+
+func (e *SeekableEncoder) Seek(offset int64, whence int) (int64, error) {
+	return e.buffer.Seek(offset, whence)
+}
+
+func (e *SeekableEncoder) Close() error {
+	_, err := e.buffer.WriteTo(e.encoder)
+	if err != nil {
+		return err
+	}
+	return e.encoder.Close()
+}
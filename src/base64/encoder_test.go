@@ -0,0 +1,133 @@
+package base64_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+
+	b64 "github.com/illikainen/go-utils/src/base64"
+	"github.com/illikainen/go-utils/src/test"
+)
+
+// encodeLines is the reference implementation of the line-wrapped encoding.
+func encodeLines(enc *base64.Encoding, data []byte, width int) string {
+	sb := &strings.Builder{}
+	chunk := enc.DecodedLen(width)
+	for len(data) > 0 {
+		size := chunk
+		if size > len(data) {
+			size = len(data)
+		}
+		sb.WriteString(enc.EncodeToString(data[:size]) + "\n")
+		data = data[size:]
+	}
+	return sb.String()
+}
+
+func TestEncoder(t *testing.T) {
+	rng := rand.New(rand.NewSource(1)) // #nosec G404
+
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawURLEncoding} {
+		for _, width := range []int{4, 64, 70, 76} {
+			for _, size := range []int{0, 1, 47, 48, 49, 1000, 200000} {
+				data := make([]byte, size)
+				_, _ = rng.Read(data)
+
+				out := &bytes.Buffer{}
+				e := b64.NewEncoder(enc, out, width)
+
+				rest := data
+				for len(rest) > 0 {
+					n := rng.Intn(300) + 1
+					if n > len(rest) {
+						n = len(rest)
+					}
+
+					written, err := e.Write(rest[:n])
+					if err != nil {
+						t.Fatal(err)
+					}
+					test.AssertEq(t, written, n)
+					rest = rest[n:]
+				}
+
+				err := e.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				test.AssertEq(t, out.String(), encodeLines(enc, data, width))
+			}
+		}
+	}
+}
+
+func TestEncoderStreaming(t *testing.T) {
+	out := &bytes.Buffer{}
+	e := b64.NewEncoder(base64.StdEncoding, out, 8)
+
+	_, err := e.Write([]byte("abcdefgh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, out.String(), "YWJjZGVm\n")
+
+	err = e.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, out.String(), "YWJjZGVm\nZ2g=\n")
+
+	_, err = e.Write([]byte("x"))
+	test.AssertNe(t, err, nil)
+
+	_, err = b64.NewEncoder(base64.StdEncoding, out, 2).Write([]byte("x"))
+	test.AssertNe(t, err, nil)
+}
+
+func TestSeekableEncoder(t *testing.T) {
+	out := &bytes.Buffer{}
+	e := b64.NewSeekableEncoder(base64.StdEncoding, out, 64)
+
+	_, err := e.Write([]byte("xbc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = e.Seek(0, io.SeekStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = e.Write([]byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = e.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, out.String(), "YWJj\n")
+
+	out.Reset()
+	e = b64.NewSeekableEncoder(base64.StdEncoding, out, 64)
+
+	_, err = e.Seek(70000, io.SeekStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = e.Write([]byte("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = e.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, out.String(), encodeLines(base64.StdEncoding, append(make([]byte, 70000), 'x'), 64))
+}
@@ -0,0 +1,112 @@
+package bpf
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// Assembler builds classic BPF programs with symbolic jump targets.  An empty
+// label refers to the next instruction.
+type Assembler struct {
+	insns  []pending
+	labels map[string]int
+}
+
+type pending struct {
+	Instruction
+	jt string
+	jf string
+}
+
+func NewAssembler() *Assembler {
+	return &Assembler{labels: map[string]int{}}
+}
+
+func (a *Assembler) Label(name string) *Assembler {
+	a.labels[name] = len(a.insns)
+	return a
+}
+
+func (a *Assembler) LoadAbs(offset uint32) *Assembler {
+	a.insns = append(a.insns, pending{Instruction: Instruction{Code: LD | W | ABS, K: offset}})
+	return a
+}
+
+func (a *Assembler) And(k uint32) *Assembler {
+	a.insns = append(a.insns, pending{Instruction: Instruction{Code: ALU | AND | K, K: k}})
+	return a
+}
+
+func (a *Assembler) JumpIf(op uint16, k uint32, jt string, jf string) *Assembler {
+	a.insns = append(a.insns, pending{
+		Instruction: Instruction{Code: JMP | op | K, K: k},
+		jt:          jt,
+		jf:          jf,
+	})
+	return a
+}
+
+func (a *Assembler) Jump(label string) *Assembler {
+	a.insns = append(a.insns, pending{Instruction: Instruction{Code: JMP | JA}, jt: label})
+	return a
+}
+
+func (a *Assembler) Ret(k uint32) *Assembler {
+	a.insns = append(a.insns, pending{Instruction: Instruction{Code: RET | K, K: k}})
+	return a
+}
+
+func (a *Assembler) Assemble() ([]Instruction, error) {
+	if len(a.insns) == 0 || len(a.insns) > MaxInstructions {
+		return nil, errors.Wrapf(ErrInvalidProgram, "%d instructions", len(a.insns))
+	}
+
+	prog := make([]Instruction, 0, len(a.insns))
+	for pc, insn := range a.insns {
+		jt, err := a.offset(pc, insn.jt)
+		if err != nil {
+			return nil, err
+		}
+
+		jf, err := a.offset(pc, insn.jf)
+		if err != nil {
+			return nil, err
+		}
+
+		if insn.Code == JMP|JA {
+			insn.K = uint32(jt)
+		} else if insn.Code&0x07 == JMP {
+			if jt > math.MaxUint8 || jf > math.MaxUint8 {
+				return nil, errors.Wrapf(ErrInvalidProgram, "jump at %d is out of range", pc)
+			}
+			insn.Jt = uint8(jt)
+			insn.Jf = uint8(jf)
+		}
+
+		prog = append(prog, insn.Instruction)
+	}
+
+	if prog[len(prog)-1].Code != RET|K {
+		return nil, errors.Wrap(ErrInvalidProgram, "missing return")
+	}
+
+	return prog, nil
+}
+
+func (a *Assembler) offset(pc int, label string) (int, error) {
+	if label == "" {
+		return 0, nil
+	}
+
+	target, ok := a.labels[label]
+	if !ok {
+		return 0, errors.Wrapf(ErrInvalidProgram, "undefined label %s", label)
+	}
+
+	if target <= pc || target >= len(a.insns) {
+		return 0, errors.Wrapf(ErrInvalidProgram, "invalid jump from %d to %s", pc, label)
+	}
+
+	return target - pc - 1, nil
+}
@@ -0,0 +1,137 @@
+package bpf
+
+import (
+	"encoding/binary"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+// Instruction classes, sizes, modes, operations and sources from
+// <linux/bpf_common.h>.  Only the subset that's useful for classic BPF
+// programs such as seccomp filters is provided.
+const (
+	LD   = 0x00
+	LDX  = 0x01
+	ALU  = 0x04
+	JMP  = 0x05
+	RET  = 0x06
+	W    = 0x00
+	ABS  = 0x20
+	AND  = 0x50
+	JA   = 0x00
+	JEQ  = 0x10
+	JGT  = 0x20
+	JGE  = 0x30
+	JSET = 0x40
+	K    = 0x00
+)
+
+// InstructionSize is the size of a marshalled `struct sock_filter`.
+const InstructionSize = 8
+
+// MaxInstructions is the BPF_MAXINSNS limit enforced by the kernel.
+const MaxInstructions = 4096
+
+var ErrInvalidProgram = errors.New("invalid bpf program")
+
+// NativeEndian is the byte order of the host.  Classic BPF programs and the
+// data they operate on (e.g., `struct seccomp_data`) are in host order.
+//
+// TODO: replace with `binary.NativeEndian` from stdlib when Debian 13 is
+// released.
+var NativeEndian = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 { // #nosec G103
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+type Instruction struct {
+	Code uint16
+	Jt   uint8
+	Jf   uint8
+	K    uint32
+}
+
+func Marshal(prog []Instruction, order binary.ByteOrder) []byte {
+	data := make([]byte, len(prog)*InstructionSize)
+	for i, insn := range prog {
+		b := data[i*InstructionSize:]
+		order.PutUint16(b[0:], insn.Code)
+		b[2] = insn.Jt
+		b[3] = insn.Jf
+		order.PutUint32(b[4:], insn.K)
+	}
+	return data
+}
+
+func Unmarshal(data []byte, order binary.ByteOrder) ([]Instruction, error) {
+	if len(data)%InstructionSize != 0 {
+		return nil, errors.Wrapf(ErrInvalidProgram, "size %d", len(data))
+	}
+
+	prog := make([]Instruction, 0, len(data)/InstructionSize)
+	for i := 0; i < len(data); i += InstructionSize {
+		prog = append(prog, Instruction{
+			Code: order.Uint16(data[i:]),
+			Jt:   data[i+2],
+			Jf:   data[i+3],
+			K:    order.Uint32(data[i+4:]),
+		})
+	}
+	return prog, nil
+}
+
+// Run executes a program against `data` and returns the value of the RET
+// instruction that terminated it.  Only the instructions emitted by the
+// Assembler are supported.  It's intended for testing programs without
+// loading them into the kernel.
+func Run(prog []Instruction, data []byte, order binary.ByteOrder) (uint32, error) {
+	if len(prog) == 0 || len(prog) > MaxInstructions {
+		return 0, errors.Wrapf(ErrInvalidProgram, "%d instructions", len(prog))
+	}
+
+	a := uint32(0)
+	for pc := 0; pc < len(prog); pc++ {
+		insn := prog[pc]
+
+		switch insn.Code {
+		case LD | W | ABS:
+			if uint64(insn.K)+4 > uint64(len(data)) {
+				return 0, errors.Wrapf(ErrInvalidProgram, "out-of-bounds load at %d", pc)
+			}
+			a = order.Uint32(data[insn.K:])
+		case ALU | AND | K:
+			a &= insn.K
+		case RET | K:
+			return insn.K, nil
+		case JMP | JA:
+			pc += int(insn.K)
+		case JMP | JEQ | K, JMP | JGT | K, JMP | JGE | K, JMP | JSET | K:
+			if jump(insn.Code, a, insn.K) {
+				pc += int(insn.Jt)
+			} else {
+				pc += int(insn.Jf)
+			}
+		default:
+			return 0, errors.Wrapf(ErrInvalidProgram, "unsupported instruction 0x%x at %d", insn.Code, pc)
+		}
+	}
+
+	return 0, errors.Wrap(ErrInvalidProgram, "missing return")
+}
+
+func jump(code uint16, a uint32, k uint32) bool {
+	switch code &^ (JMP | K) {
+	case JEQ:
+		return a == k
+	case JGT:
+		return a > k
+	case JGE:
+		return a >= k
+	default:
+		return a&k != 0
+	}
+}
@@ -0,0 +1,96 @@
+package bpf_test
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/illikainen/go-utils/src/bpf"
+	"github.com/illikainen/go-utils/src/test"
+)
+
+func TestAssemble(t *testing.T) {
+	prog, err := bpf.NewAssembler().
+		LoadAbs(0).
+		JumpIf(bpf.JEQ, 1, "one", "").
+		JumpIf(bpf.JGT, 10, "", "small").
+		Ret(3).
+		Label("one").Ret(1).
+		Label("small").Ret(2).
+		Assemble()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.AssertEq(t, prog, []bpf.Instruction{
+		{Code: bpf.LD | bpf.W | bpf.ABS, K: 0},
+		{Code: bpf.JMP | bpf.JEQ | bpf.K, Jt: 2, Jf: 0, K: 1},
+		{Code: bpf.JMP | bpf.JGT | bpf.K, Jt: 0, Jf: 2, K: 10},
+		{Code: bpf.RET | bpf.K, K: 3},
+		{Code: bpf.RET | bpf.K, K: 1},
+		{Code: bpf.RET | bpf.K, K: 2},
+	})
+
+	for n, expected := range map[uint32]uint32{0: 2, 1: 1, 10: 2, 11: 3} {
+		data := make([]byte, 4)
+		binary.LittleEndian.PutUint32(data, n)
+
+		ret, err := bpf.Run(prog, data, binary.LittleEndian)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.AssertEq(t, ret, expected)
+	}
+}
+
+func TestAssembleInvalid(t *testing.T) {
+	_, err := bpf.NewAssembler().Assemble()
+	test.AssertNe(t, err, nil)
+
+	_, err = bpf.NewAssembler().LoadAbs(0).Assemble()
+	test.AssertNe(t, err, nil)
+
+	_, err = bpf.NewAssembler().JumpIf(bpf.JEQ, 0, "missing", "").Ret(0).Assemble()
+	test.AssertNe(t, err, nil)
+
+	_, err = bpf.NewAssembler().Label("back").LoadAbs(0).Jump("back").Ret(0).Assemble()
+	test.AssertNe(t, err, nil)
+
+	asm := bpf.NewAssembler().JumpIf(bpf.JEQ, 0, "far", "")
+	for i := 0; i < 256; i++ {
+		asm.Ret(0)
+	}
+	_, err = asm.Label("far").Ret(1).Assemble()
+	test.AssertNe(t, err, nil)
+}
+
+func TestMarshal(t *testing.T) {
+	prog := []bpf.Instruction{
+		{Code: bpf.JMP | bpf.JEQ | bpf.K, Jt: 1, Jf: 2, K: 0x01020304},
+		{Code: bpf.RET | bpf.K, K: 0x7fff0000},
+	}
+
+	data := bpf.Marshal(prog, binary.LittleEndian)
+	test.AssertEq(t, data, []byte{
+		0x15, 0x00, 0x01, 0x02, 0x04, 0x03, 0x02, 0x01,
+		0x06, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0x7f,
+	})
+
+	out, err := bpf.Unmarshal(data, binary.LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, out, prog)
+
+	_, err = bpf.Unmarshal(data[1:], binary.LittleEndian)
+	test.AssertNe(t, err, nil)
+}
+
+func TestRunOutOfBounds(t *testing.T) {
+	prog, err := bpf.NewAssembler().LoadAbs(4).Ret(0).Assemble()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = bpf.Run(prog, make([]byte, 4), binary.LittleEndian)
+	test.AssertNe(t, err, nil)
+}
@@ -0,0 +1,299 @@
+package buffer
+
+import (
+	"io"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultMaxFileSize is the default size limit of a File.
+const DefaultMaxFileSize = 1 << 30
+
+// ErrFileTooLarge is returned if a write or truncation would grow a File
+// beyond its size limit.
+var ErrFileTooLarge = errors.New("file too large")
+
+// File is an in-memory stand-in for *os.File.  It's safe for concurrent use.
+// The content is stored contiguously, so the size is limited to avoid huge
+// allocations from writes far beyond the end.
+type File struct {
+	mu       sync.Mutex
+	name     string
+	modTime  time.Time
+	data     []byte
+	maxSize  int
+	position int64
+	closed   bool
+}
+
+type FileOptions struct {
+	// Name is returned by Name() and Stat().  It defaults to "buffer".
+	Name string
+
+	// ModTime is the initial modification time.  It defaults to the
+	// creation time, and it's updated by writes.
+	ModTime time.Time
+
+	// Data is the initial content.  It's copied.
+	Data []byte
+
+	// MaxSize is the size limit.  It defaults to DefaultMaxFileSize.  The
+	// content is allocated up to the limit as the file grows, and running
+	// out of memory is fatal in Go, so the limit should be within the
+	// memory that's available to the process.
+	MaxSize int64
+}
+
+func NewFile(opts *FileOptions) *File {
+	if opts == nil {
+		opts = &FileOptions{}
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = "buffer"
+	}
+
+	modTime := opts.ModTime
+	if modTime.IsZero() {
+		modTime = time.Now()
+	}
+
+	maxSize := opts.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxFileSize
+	}
+	if maxSize > math.MaxInt {
+		maxSize = math.MaxInt
+	}
+
+	return &File{
+		name:    name,
+		modTime: modTime,
+		data:    append([]byte{}, opts.Data...),
+		maxSize: int(maxSize),
+	}
+}
+
+func (f *File) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, f.closedError("read")
+	}
+
+	n, err := f.readAt(p, f.position)
+	f.position += int64(n)
+	return n, err
+}
+
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, f.closedError("read")
+	}
+	if off < 0 {
+		return 0, errors.Errorf("invalid offset: %d", off)
+	}
+
+	n, err := f.readAt(p, off)
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *File) readAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(f.data)) {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	return copy(p, f.data[off:]), nil
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, f.closedError("write")
+	}
+
+	n, err := f.writeAt(p, f.position)
+	f.position += int64(n)
+	return n, err
+}
+
+// WriteAt writes at off without changing the position.  Writing beyond the
+// end of the file fills the gap with zeros.
+func (f *File) WriteAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, f.closedError("write")
+	}
+	if off < 0 {
+		return 0, errors.Errorf("invalid offset: %d", off)
+	}
+
+	return f.writeAt(p, off)
+}
+
+func (f *File) writeAt(p []byte, off int64) (int, error) {
+	if off > int64(f.maxSize-len(p)) {
+		return 0, errors.Wrapf(ErrFileTooLarge, "%s", f.name)
+	}
+
+	end := int(off) + len(p)
+	if end > len(f.data) {
+		err := f.resize(int64(end))
+		if err != nil {
+			return 0, err
+		}
+	}
+	copy(f.data[off:], p)
+
+	if len(p) > 0 {
+		f.modTime = time.Now()
+	}
+	return len(p), nil
+}
+
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, f.closedError("seek")
+	}
+
+	var base int64
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		base = f.position
+	case io.SeekEnd:
+		base = int64(len(f.data))
+	default:
+		return 0, errors.Errorf("invalid whence: %d", whence)
+	}
+
+	if (offset > 0 && base > math.MaxInt64-offset) || base+offset < 0 {
+		return 0, errors.Errorf("invalid offset: %d", offset)
+	}
+
+	f.position = base + offset
+	return f.position, nil
+}
+
+// Truncate changes the size of the file without changing the position.
+func (f *File) Truncate(size int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return f.closedError("truncate")
+	}
+	if size < 0 {
+		return errors.Errorf("invalid size: %d", size)
+	}
+
+	err := f.resize(size)
+	if err != nil {
+		return err
+	}
+
+	f.modTime = time.Now()
+	return nil
+}
+
+// resize grows the file with zeros or shrinks it to size bytes.  The size is
+// checked against the limit before anything is allocated.
+func (f *File) resize(size64 int64) error {
+	if size64 > int64(f.maxSize) {
+		return errors.Wrapf(ErrFileTooLarge, "%s", f.name)
+	}
+
+	size := int(size64)
+	if size <= len(f.data) {
+		f.data = f.data[:size]
+		return nil
+	}
+
+	if size <= cap(f.data) {
+		tail := f.data[len(f.data):size]
+		for i := range tail {
+			tail[i] = 0
+		}
+		f.data = f.data[:size]
+		return nil
+	}
+
+	capacity := f.maxSize
+	if size <= f.maxSize-size/4 {
+		capacity = size + size/4
+	}
+
+	data := make([]byte, size, capacity)
+	copy(data, f.data)
+	f.data = data
+	return nil
+}
+
+func (f *File) Stat() (os.FileInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil, f.closedError("stat")
+	}
+	return &FileInfo{name: f.name, size: int64(len(f.data)), modTime: f.modTime}, nil
+}
+
+func (f *File) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return f.closedError("sync")
+	}
+	return nil
+}
+
+func (f *File) Name() string {
+	return f.name
+}
+
+// Bytes returns a copy of the content.  It's available after Close().
+func (f *File) Bytes() []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]byte{}, f.data...)
+}
+
+// Close makes subsequent operations fail with os.ErrClosed.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return f.closedError("close")
+	}
+	f.closed = true
+	return nil
+}
+
+func (f *File) closedError(op string) error {
+	return errors.WithStack(&os.PathError{Op: op, Path: f.name, Err: os.ErrClosed})
+}
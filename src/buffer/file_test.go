@@ -0,0 +1,164 @@
+package buffer_test
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/illikainen/go-utils/src/buffer"
+	"github.com/illikainen/go-utils/src/iofs"
+	"github.com/illikainen/go-utils/src/test"
+
+	"github.com/pkg/errors"
+)
+
+func TestFile(t *testing.T) {
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	f := buffer.NewFile(&buffer.FileOptions{Name: "file", ModTime: modTime, Data: []byte("hello")})
+
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, info.Name(), "file")
+	test.AssertEq(t, info.Size(), int64(5))
+	test.AssertEq(t, info.ModTime(), modTime)
+
+	_, err = f.Seek(0, io.SeekEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Write([]byte(" world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, string(f.Bytes()), "hello world")
+
+	info, err = f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, info.ModTime().After(modTime), true)
+
+	buf := make([]byte, 5)
+	n, err := f.ReadAt(buf, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, string(buf[:n]), "world")
+
+	n, err = f.ReadAt(buf, 8)
+	test.AssertEq(t, err, io.EOF)
+	test.AssertEq(t, string(buf[:n]), "rld")
+
+	_, err = f.WriteAt([]byte("!"), 13)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, f.Bytes(), []byte("hello world\x00\x00!"))
+
+	err = f.Truncate(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Truncate(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, f.Bytes(), []byte("hello\x00\x00"))
+
+	pos, err := f.Seek(-2, io.SeekCurrent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, pos, int64(9))
+
+	_, err = f.Read(buf)
+	test.AssertEq(t, err, io.EOF)
+
+	_, err = f.Seek(-1, io.SeekStart)
+	test.AssertNe(t, err, nil)
+
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = f.Read(buf)
+	test.AssertEq(t, errors.Is(err, os.ErrClosed), true)
+	test.AssertEq(t, errors.Is(f.Close(), os.ErrClosed), true)
+	test.AssertEq(t, f.Bytes(), []byte("hello\x00\x00"))
+}
+
+func TestFileMaxSize(t *testing.T) {
+	f := buffer.NewFile(&buffer.FileOptions{MaxSize: 8})
+
+	_, err := f.Seek(1<<40, io.SeekStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = f.Write([]byte("x"))
+	test.AssertEq(t, errors.Is(err, buffer.ErrFileTooLarge), true)
+
+	_, err = f.WriteAt([]byte("x"), math.MaxInt64-1)
+	test.AssertEq(t, errors.Is(err, buffer.ErrFileTooLarge), true)
+
+	err = f.Truncate(9)
+	test.AssertEq(t, errors.Is(err, buffer.ErrFileTooLarge), true)
+
+	_, err = f.WriteAt([]byte("12345678"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = f.WriteAt([]byte("9"), 8)
+	test.AssertEq(t, errors.Is(err, buffer.ErrFileTooLarge), true)
+	test.AssertEq(t, string(f.Bytes()), "12345678")
+}
+
+func TestFileCopy(t *testing.T) {
+	src := buffer.NewFile(&buffer.FileOptions{Data: bytes.Repeat([]byte("x"), 100000)})
+	dst := buffer.NewFile(nil)
+
+	_, err := src.Seek(10, io.SeekStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = iofs.Copy(dst, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, dst.Bytes(), bytes.Repeat([]byte("x"), 99990))
+	test.AssertEq(t, dst.Name(), "buffer")
+}
+
+func TestFileConcurrent(t *testing.T) {
+	f := buffer.NewFile(nil)
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := f.WriteAt([]byte{byte(i)}, int64(j*16+i))
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	data := f.Bytes()
+	test.AssertEq(t, len(data), 1600)
+	for i, b := range data {
+		test.AssertEq(t, b, byte(i%16))
+	}
+}
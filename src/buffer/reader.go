@@ -68,12 +68,19 @@ func (r *Reader) Stat() (os.FileInfo, error) {
 	return &FileInfo{size: int64(size)}, nil
 }
 
+// FileInfo describes a buffer.  The name defaults to "buffer", and the
+// modification time defaults to the current time.
 type FileInfo struct {
-	size int64
+	name    string
+	size    int64
+	modTime time.Time
 }
 
 func (fi *FileInfo) Name() string {
-	return "buffer"
+	if fi.name == "" {
+		return "buffer"
+	}
+	return fi.name
 }
 
 func (fi *FileInfo) Size() int64 {
@@ -85,7 +92,10 @@ func (fi *FileInfo) Mode() os.FileMode {
 }
 
 func (fi *FileInfo) ModTime() time.Time {
-	return time.Now()
+	if fi.modTime.IsZero() {
+		return time.Now()
+	}
+	return fi.modTime
 }
 
 func (fi *FileInfo) IsDir() bool {
@@ -3,13 +3,44 @@ package buffer
 import (
 	"io"
 	"math"
+	"sort"
 
 	"github.com/pkg/errors"
 )
 
+// ChunkSize is the size of the chunks that make up a Writer.
+const ChunkSize = 64 << 10
+
+// minChunkSize is the initial capacity of a chunk.  Chunks grow like
+// slices until they reach ChunkSize.
+const minChunkSize = 64
+
+// MaxBytesSize is the largest Writer that can be copied with Bytes().
+// Larger writers, e.g. sparse writers with holes far beyond the data, should
+// be streamed with WriteTo() instead.
+const MaxBytesSize = 1 << 30
+
+// ErrTooLarge is returned by Bytes() if the content is larger than
+// MaxBytesSize.
+var ErrTooLarge = errors.New("buffer too large")
+
+var zeros = make([]byte, ChunkSize)
+
+// Writer is a seekable in-memory writer.  The data is stored in chunks of
+// ChunkSize bytes, so growing the writer never copies the existing data.
+// Chunks that have never been written are holes that read as zeros and
+// don't use any memory, so seeking far beyond the end is cheap.
 type Writer struct {
-	data     []byte
-	position int
+	// chunks are sorted by index.  Bytes beyond the length of a chunk
+	// but before the end of the writer are zeros.
+	chunks   []*chunk
+	size     int64
+	position int64
+}
+
+type chunk struct {
+	index int64
+	data  []byte
 }
 
 func NewWriter() *Writer {
@@ -17,51 +48,292 @@ func NewWriter() *Writer {
 }
 
 func (w *Writer) Write(p []byte) (int, error) {
-	size := len(w.data)
-	if w.position > size {
-		chunk := make([]byte, w.position-size)
-		w.data = append(w.data, chunk...)
+	if w.position > math.MaxInt64-int64(len(p)) {
+		return 0, errors.Errorf("invalid position: %d", w.position)
 	}
 
-	if w.position == size {
-		w.data = append(w.data, p...)
-	} else {
-		for i := 0; i < len(p); i++ {
-			if w.position+i < len(w.data) {
-				w.data[w.position+i] = p[i]
+	// Fast path for appends that fit in the last chunk.
+	if n := len(w.chunks); n > 0 && w.position == w.size {
+		c := w.chunks[n-1]
+		if c.index*ChunkSize+int64(len(c.data)) == w.position && len(c.data)+len(p) <= cap(c.data) {
+			c.data = append(c.data, p...)
+			w.advance(int64(len(p)))
+			return len(p), nil
+		}
+	}
+
+	written := 0
+	for written < len(p) {
+		c, offset := w.chunk(w.position, minChunkSize)
+		n := copy(c.extend(offset, len(p)-written), p[written:])
+		written += n
+		w.advance(int64(n))
+	}
+
+	return written, nil
+}
+
+// ReadFrom reads from r until EOF and writes the data at the current
+// position.  Appended data is read directly into the chunks.
+func (w *Writer) ReadFrom(r io.Reader) (int64, error) {
+	var total int64
+	var tmp []byte
+
+	for {
+		c, offset := w.chunk(w.position, ChunkSize)
+
+		var n int
+		var err error
+		if old := len(c.data); offset >= old {
+			// The reader may use the whole buffer as scratch space,
+			// so only unused parts of a chunk can be read into.
+			n, err = r.Read(c.extend(offset, ChunkSize-offset))
+			if n > 0 {
+				c.data = c.data[:offset+n]
 			} else {
-				w.data = append(w.data, p[i])
+				c.data = c.data[:old]
 			}
+		} else {
+			if tmp == nil {
+				tmp = make([]byte, ChunkSize)
+			}
+			n, err = r.Read(tmp[:ChunkSize-offset])
+			copy(c.extend(offset, n), tmp[:n])
+		}
+
+		total += int64(n)
+		w.advance(int64(n))
+
+		if errors.Is(err, io.EOF) {
+			w.trim(c)
+			return total, nil
+		}
+		if err != nil {
+			w.trim(c)
+			return total, err
 		}
 	}
+}
 
-	w.position += len(p)
-	return len(p), nil
+// WriteTo writes the content to w.  Holes are written as zeros.  The
+// position is unchanged.
+func (w *Writer) WriteTo(dst io.Writer) (int64, error) {
+	var total int64
+	err := w.each(func(data []byte) error {
+		n, err := dst.Write(data)
+		total += int64(n)
+		if err == nil && n < len(data) {
+			err = io.ErrShortWrite
+		}
+		return err
+	})
+	return total, err
 }
 
 func (w *Writer) Seek(offset int64, whence int) (int64, error) {
-	if offset < math.MinInt || offset > math.MaxInt-int64(len(w.data)) {
-		return 0, errors.Errorf("invalid offset: %d", offset)
-	}
-
+	var base int64
 	switch whence {
 	case io.SeekStart:
-		w.position = int(offset)
 	case io.SeekCurrent:
-		w.position += int(offset)
+		base = w.position
 	case io.SeekEnd:
-		w.position = len(w.data) + int(offset)
+		base = w.size
 	default:
 		return 0, errors.Errorf("invalid whence: %d", whence)
 	}
 
-	//lint:ignore SA4003 sanity
-	if w.position < 0 || w.position < math.MinInt64 || w.position > math.MaxInt64 {
-		return 0, errors.Errorf("invalid position: %d", w.position)
+	if (offset > 0 && base > math.MaxInt64-offset) || base+offset < 0 {
+		return 0, errors.Errorf("invalid offset: %d", offset)
 	}
-	return int64(w.position), nil
+
+	w.position = base + offset
+	return w.position, nil
+}
+
+// Bytes returns a contiguous copy of the content.  Holes are copied as
+// zeros, so it fails with ErrTooLarge if the size exceeds MaxBytesSize.
+func (w *Writer) Bytes() ([]byte, error) {
+	if w.size > MaxBytesSize {
+		return nil, errors.Wrapf(ErrTooLarge, "%d bytes", w.size)
+	}
+
+	data := make([]byte, 0, w.size)
+	_ = w.each(func(chunk []byte) error {
+		data = append(data, chunk...)
+		return nil
+	})
+	return data, nil
 }
 
-func (w *Writer) Bytes() []byte {
-	return w.data
+// Len returns the size of the content.  A position beyond the end doesn't
+// count until something is written there.
+func (w *Writer) Len() int64 {
+	return w.size
+}
+
+// Reset discards the content and rewinds the position.
+func (w *Writer) Reset() {
+	w.chunks = nil
+	w.size = 0
+	w.position = 0
+}
+
+// Grow allocates memory so that the next n bytes can be written at the
+// current position without further allocations.
+func (w *Writer) Grow(n int) {
+	if n < 0 {
+		panic("buffer.Writer.Grow: negative count")
+	}
+	if w.position > math.MaxInt64-int64(n) {
+		panic("buffer.Writer.Grow: too large")
+	}
+
+	end := w.position + int64(n)
+	for pos := w.position; pos < end; pos += ChunkSize - pos%ChunkSize {
+		w.chunk(pos, ChunkSize)
+	}
+}
+
+// each calls fn with the content in order, including zeros for holes.
+func (w *Writer) each(fn func([]byte) error) error {
+	var pos int64
+	for _, c := range w.chunks {
+		start := c.index * ChunkSize
+		if start >= w.size {
+			// Chunks that are preallocated by Grow() can be beyond
+			// the end.
+			break
+		}
+
+		err := w.zeros(pos, start, fn)
+		if err != nil {
+			return err
+		}
+
+		if len(c.data) > 0 {
+			err = fn(c.data)
+			if err != nil {
+				return err
+			}
+		}
+		pos = start + int64(len(c.data))
+	}
+	return w.zeros(pos, w.size, fn)
+}
+
+func (w *Writer) zeros(start int64, end int64, fn func([]byte) error) error {
+	for start < end {
+		n := end - start
+		if n > ChunkSize {
+			n = ChunkSize
+		}
+
+		err := fn(zeros[:n])
+		if err != nil {
+			return err
+		}
+		start += n
+	}
+	return nil
+}
+
+// chunk returns the chunk for pos and the offset of pos in it.  Missing
+// chunks are created with at least the given capacity.
+func (w *Writer) chunk(pos int64, capacity int) (*chunk, int) {
+	index := pos / ChunkSize
+	offset := int(pos % ChunkSize)
+
+	i := len(w.chunks)
+	if i == 0 || w.chunks[i-1].index < index {
+		// Fast path for appends.
+	} else {
+		i = sort.Search(len(w.chunks), func(i int) bool {
+			return w.chunks[i].index >= index
+		})
+	}
+
+	var c *chunk
+	if i < len(w.chunks) && w.chunks[i].index == index {
+		c = w.chunks[i]
+	} else {
+		// Only the first chunk starts small.  Writers that need more
+		// than one chunk are likely to fill the others.
+		if len(w.chunks) > 0 {
+			capacity = ChunkSize
+		}
+
+		c = &chunk{index: index}
+		w.chunks = append(w.chunks, nil)
+		copy(w.chunks[i+1:], w.chunks[i:])
+		w.chunks[i] = c
+	}
+
+	if cap(c.data) < capacity {
+		c.grow(capacity)
+	}
+	return c, offset
+}
+
+// advance moves the position and extends the size if needed.
+func (w *Writer) advance(n int64) {
+	w.position += n
+	if w.position > w.size {
+		w.size = w.position
+	}
+}
+
+// trim removes a chunk that was created by ReadFrom() without receiving any
+// data.
+func (w *Writer) trim(c *chunk) {
+	if len(c.data) > 0 {
+		return
+	}
+
+	for i, other := range w.chunks {
+		if other == c {
+			w.chunks = append(w.chunks[:i], w.chunks[i+1:]...)
+			return
+		}
+	}
+}
+
+// extend returns the part of the chunk that starts at offset, with room
+// for up to n bytes.  Bytes between the old length and offset are zeroed.
+func (c *chunk) extend(offset int, n int) []byte {
+	if n > ChunkSize-offset {
+		n = ChunkSize - offset
+	}
+
+	end := offset + n
+	if end > cap(c.data) {
+		c.grow(end)
+	}
+
+	if end > len(c.data) {
+		old := len(c.data)
+		c.data = c.data[:end]
+		if offset > old {
+			copy(c.data[old:offset], zeros)
+		}
+	}
+	return c.data[offset:end]
+}
+
+// grow reallocates the chunk with room for at least size bytes.  The
+// capacity doubles up to ChunkSize to amortize the copies of small chunks.
+func (c *chunk) grow(size int) {
+	capacity := 2 * cap(c.data)
+	if capacity < minChunkSize {
+		capacity = minChunkSize
+	}
+	if capacity < size {
+		capacity = size
+	}
+	if capacity > ChunkSize {
+		capacity = ChunkSize
+	}
+
+	data := make([]byte, len(c.data), capacity)
+	copy(data, c.data)
+	c.data = data
 }
@@ -0,0 +1,192 @@
+package buffer_test
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+
+	"github.com/illikainen/go-utils/src/buffer"
+	"github.com/illikainen/go-utils/src/test"
+
+	"github.com/pkg/errors"
+)
+
+// model is the reference implementation of a seekable writer.
+type model struct {
+	data     []byte
+	position int
+}
+
+func (m *model) write(p []byte) {
+	if end := m.position + len(p); end > len(m.data) {
+		m.data = append(m.data, make([]byte, end-len(m.data))...)
+	}
+	copy(m.data[m.position:], p)
+	m.position += len(p)
+}
+
+func TestWriter(t *testing.T) {
+	rng := rand.New(rand.NewSource(1)) // #nosec G404
+	w := buffer.NewWriter()
+	m := &model{}
+
+	for i := 0; i < 2000; i++ {
+		switch rng.Intn(4) {
+		case 0:
+			pos := rng.Intn(len(m.data) + 3*buffer.ChunkSize)
+			n, err := w.Seek(int64(pos), io.SeekStart)
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.AssertEq(t, n, int64(pos))
+			m.position = pos
+		case 1:
+			data := make([]byte, rng.Intn(100))
+			_, _ = rng.Read(data)
+			_, err := w.ReadFrom(iotest.HalfReader(bytes.NewReader(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			m.write(data)
+		default:
+			data := make([]byte, rng.Intn(2*buffer.ChunkSize))
+			_, _ = rng.Read(data)
+			n, err := w.Write(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.AssertEq(t, n, len(data))
+			m.write(data)
+		}
+
+		test.AssertEq(t, w.Len(), int64(len(m.data)))
+	}
+
+	data, err := w.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, bytes.Equal(data, m.data), true)
+
+	out := &bytes.Buffer{}
+	n, err := w.WriteTo(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, n, int64(len(m.data)))
+	test.AssertEq(t, bytes.Equal(out.Bytes(), m.data), true)
+}
+
+func TestWriterSparse(t *testing.T) {
+	w := buffer.NewWriter()
+
+	_, err := w.Seek(1<<40, io.SeekStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, w.Len(), int64(0))
+
+	_, err = w.Write([]byte("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, w.Len(), int64(1<<40+1))
+
+	w.Reset()
+	test.AssertEq(t, w.Len(), int64(0))
+
+	_, err = w.Seek(10, io.SeekStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Grow(3 * buffer.ChunkSize)
+	test.AssertEq(t, w.Len(), int64(0))
+
+	_, err = w.Write([]byte("abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := w.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, data, append(make([]byte, 10), "abc"...))
+
+	_, err = w.Seek(-1, io.SeekStart)
+	test.AssertNe(t, err, nil)
+
+	_, err = w.Seek(1<<40, io.SeekStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = w.Write([]byte("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = w.Bytes()
+	test.AssertEq(t, errors.Is(err, buffer.ErrTooLarge), true)
+}
+
+func benchmarkAppend(b *testing.B, size int, newWriter func() io.Writer) {
+	data := make([]byte, size)
+	b.SetBytes(1 << 24)
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		w := newWriter()
+		for written := 0; written < 1<<24; written += size {
+			_, err := w.Write(data)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkWriterAppendSmall(b *testing.B) {
+	benchmarkAppend(b, 64, func() io.Writer { return buffer.NewWriter() })
+}
+
+func BenchmarkBytesBufferAppendSmall(b *testing.B) {
+	benchmarkAppend(b, 64, func() io.Writer { return &bytes.Buffer{} })
+}
+
+func BenchmarkWriterAppendLarge(b *testing.B) {
+	benchmarkAppend(b, 1<<20, func() io.Writer { return buffer.NewWriter() })
+}
+
+func BenchmarkBytesBufferAppendLarge(b *testing.B) {
+	benchmarkAppend(b, 1<<20, func() io.Writer { return &bytes.Buffer{} })
+}
+
+func BenchmarkWriterReadFrom(b *testing.B) {
+	data := make([]byte, 1<<24)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		w := buffer.NewWriter()
+		_, err := w.ReadFrom(bytes.NewReader(data))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBytesBufferReadFrom(b *testing.B) {
+	data := make([]byte, 1<<24)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		w := &bytes.Buffer{}
+		_, err := w.ReadFrom(bytes.NewReader(data))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
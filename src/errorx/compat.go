@@ -61,6 +61,15 @@ func (e *MultiError) Unwrap() error {
 	return nil
 }
 
+func (e *MultiError) As(target any) bool {
+	for _, err := range e.errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
 func (e *MultiError) Is(target error) bool {
 	for _, err := range e.errs {
 		if errors.Is(err, target) {
@@ -19,7 +19,10 @@ func WithSuppress(fn func() error) error {
 	return err
 }
 
+// SanitizedJSONFormatter formats entries as JSON that's sanitized with
+// Policy, or with stringx.DefaultPolicy if it's nil.
 type SanitizedJSONFormatter struct {
+	Policy *stringx.Policy
 }
 
 func (f *SanitizedJSONFormatter) Format(e *log.Entry) ([]byte, error) {
@@ -28,15 +31,24 @@ func (f *SanitizedJSONFormatter) Format(e *log.Entry) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	return stringx.Sanitize(out), nil
+	return policy(f.Policy).Sanitize(out)
 }
 
+// SanitizedTextFormatter formats entries as text where the messages are
+// sanitized with Policy, or with stringx.DefaultPolicy if it's nil.
 type SanitizedTextFormatter struct {
+	Policy *stringx.Policy
 }
 
 func (f *SanitizedTextFormatter) Format(entry *log.Entry) ([]byte, error) {
+	p := policy(f.Policy)
+
 	if GetField(entry.Data, "unstyled", false) {
-		return []byte(stringx.Sanitize(entry.Message) + "\n"), nil
+		msg, err := p.SanitizeString(entry.Message)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(msg + "\n"), nil
 	}
 
 	level := ""
@@ -54,11 +66,27 @@ func (f *SanitizedTextFormatter) Format(entry *log.Entry) ([]byte, error) {
 		level = color.RedString(entry.Level.String())
 	}
 
-	return seq.ExpandBy(stringx.SplitLines(entry.Message), func(line string, _ int) []byte {
-		return []byte(fmt.Sprintf("%-14s | %s\n", level, stringx.Sanitize(line)))
+	lines := []string{}
+	for _, line := range stringx.SplitLines(entry.Message) {
+		line, err := p.SanitizeString(line)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+
+	return seq.ExpandBy(lines, func(line string, _ int) []byte {
+		return []byte(fmt.Sprintf("%-14s | %s\n", level, line))
 	}), nil
 }
 
+func policy(p *stringx.Policy) *stringx.Policy {
+	if p == nil {
+		return stringx.DefaultPolicy
+	}
+	return p
+}
+
 func GetField[T bool | string](fields log.Fields, key string, fallback T) T {
 	value, ok := fields[key]
 	if !ok {
@@ -0,0 +1,279 @@
+package process
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/illikainen/go-utils/src/errorx"
+	"github.com/illikainen/go-utils/src/iofs"
+	"github.com/illikainen/go-utils/src/stringx"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// CaptureTruncate discards output beyond the limit and appends
+	// Capture.Marker to the captured data.
+	CaptureTruncate = iota
+
+	// CaptureError fails with ErrOutputLimit if the limit is exceeded.
+	CaptureError
+
+	// CaptureSpill writes the complete output to a file in a temporary
+	// directory if the limit is exceeded.  The captured data is truncated
+	// like with CaptureTruncate.
+	CaptureSpill
+)
+
+const captureChunkSize = 64 << 10
+
+// DefaultCaptureMarker is appended to truncated output.
+var DefaultCaptureMarker = []byte("\n[output truncated]\n")
+
+var ErrOutputLimit = errors.New("output limit exceeded")
+
+// Capture is a bounded alternative to CaptureOutput.  At most Limit bytes
+// are kept in memory, and Mode decides what happens to the rest.  Untrusted
+// output is sanitized with Policy, or with stringx.DefaultPolicy if it's nil.
+// A Capture can only be used for one stream at a time, and Output() fails if
+// it's already capturing another stream.  Size(), Truncated() and Path() may
+// be called while the output is captured.
+//
+//	c := process.NewCapture(1<<20, process.CaptureSpill)
+//	defer c.Close()
+//	out, err := process.Exec(&process.ExecOptions{Command: cmd, Stdout: c.Output})
+type Capture struct {
+	Limit  int64
+	Mode   int
+	Marker []byte
+	Policy *stringx.Policy
+
+	mu        sync.Mutex
+	busy      bool
+	size      int64
+	truncated bool
+	path      string
+	cleanup   func() error
+}
+
+func NewCapture(limit int64, mode int) *Capture {
+	return &Capture{Limit: limit, Mode: mode, Marker: DefaultCaptureMarker}
+}
+
+// Output is an OutputFunc.
+func (c *Capture) Output(reader io.Reader, _ int, trusted bool) (data []byte, err error) {
+	err = c.start()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.busy = false
+	}()
+
+	policy := c.Policy
+	if policy == nil {
+		policy = stringx.DefaultPolicy
+	}
+
+	w := &captureWriter{capture: c, data: []byte{}}
+	defer func() {
+		if w.spill != nil {
+			err = errorx.Join(err, w.spill.Close())
+		}
+	}()
+
+	// Untrusted chunks are sanitized up to the last complete rune or
+	// escape sequence, and the rest is kept for the next chunk.
+	buf := make([]byte, captureChunkSize)
+	pending := []byte{}
+	for {
+		n, readErr := reader.Read(buf)
+		if n > 0 {
+			c.mu.Lock()
+			c.size += int64(n)
+			c.mu.Unlock()
+			chunk := buf[:n]
+
+			if !trusted {
+				pending = append(pending, chunk...)
+
+				var consumed int
+				chunk, consumed, err = policy.SanitizePartial(pending)
+				if err != nil {
+					return nil, errors.Wrap(err, "Capture: invalid data")
+				}
+				pending = append(pending[:0], pending[consumed:]...)
+			}
+
+			err = w.write(chunk)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+
+	if len(pending) > 0 {
+		chunk, err := policy.Sanitize(pending)
+		if err != nil {
+			return nil, errors.Wrap(err, "Capture: invalid data")
+		}
+
+		err = w.write(chunk)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	data = w.data
+	if w.truncated {
+		data = append(data, c.Marker...)
+	}
+	return data, nil
+}
+
+// start resets the state of the capture for a new stream.
+func (c *Capture) start() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Limit <= 0 {
+		return errors.Errorf("Capture: invalid limit: %d", c.Limit)
+	}
+
+	if c.busy {
+		return errors.Errorf("Capture: already capturing another stream")
+	}
+
+	if c.cleanup != nil {
+		return errors.Errorf("Capture: the previous output must be closed")
+	}
+
+	c.busy = true
+	c.size = 0
+	c.truncated = false
+	return nil
+}
+
+// captureWriter keeps the output of a Capture in memory until the limit is
+// reached.
+type captureWriter struct {
+	capture   *Capture
+	data      []byte
+	spill     *os.File
+	truncated bool
+}
+
+func (w *captureWriter) write(chunk []byte) error {
+	c := w.capture
+
+	if w.spill != nil {
+		_, err := w.spill.Write(chunk)
+		return err
+	}
+
+	avail := c.Limit - int64(len(w.data))
+	if int64(len(chunk)) <= avail {
+		w.data = append(w.data, chunk...)
+		return nil
+	}
+
+	w.data = append(w.data, chunk[:avail]...)
+	w.truncated = true
+	c.mu.Lock()
+	c.truncated = true
+	c.mu.Unlock()
+
+	switch c.Mode {
+	case CaptureTruncate:
+		return nil
+	case CaptureError:
+		return errors.Wrapf(ErrOutputLimit, "%d bytes", c.Limit)
+	case CaptureSpill:
+		var err error
+		w.spill, err = c.spill(w.data, chunk[avail:])
+		return err
+	default:
+		return errors.Errorf("Capture: invalid mode: %d", c.Mode)
+	}
+}
+
+// spill creates the spill file and writes the output that has been read so
+// far to it.
+func (c *Capture) spill(head []byte, rest []byte) (*os.File, error) {
+	dir, cleanup, err := iofs.MkdirTemp()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, "output")
+
+	c.mu.Lock()
+	c.cleanup = cleanup
+	c.path = path
+	c.mu.Unlock()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, data := range [][]byte{head, rest} {
+		_, err := f.Write(data)
+		if err != nil {
+			return nil, errorx.Join(err, f.Close())
+		}
+	}
+
+	return f, nil
+}
+
+// Size returns the total number of bytes that were read.
+func (c *Capture) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// Truncated returns true if the output exceeded the limit.
+func (c *Capture) Truncated() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.truncated
+}
+
+// Path returns the file with the complete output if it was spilled to disk,
+// or an empty string.
+func (c *Capture) Path() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.path
+}
+
+// Close removes the spill file.  It fails if the output is still captured.
+func (c *Capture) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.busy {
+		return errors.Errorf("Capture: the output is still being captured")
+	}
+
+	if c.cleanup == nil {
+		return nil
+	}
+
+	err := c.cleanup()
+	c.cleanup = nil
+	c.path = ""
+	return err
+}
@@ -0,0 +1,149 @@
+package process_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/illikainen/go-utils/src/iofs"
+	"github.com/illikainen/go-utils/src/process"
+	"github.com/illikainen/go-utils/src/stringx"
+	"github.com/illikainen/go-utils/src/test"
+
+	"github.com/pkg/errors"
+)
+
+func TestCaptureTruncate(t *testing.T) {
+	c := process.NewCapture(4, process.CaptureTruncate)
+	c.Marker = []byte("...")
+
+	data, err := c.Output(strings.NewReader("abcdefgh"), process.Stdout, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.AssertEq(t, string(data), "abcd...")
+	test.AssertEq(t, c.Size(), int64(8))
+	test.AssertEq(t, c.Truncated(), true)
+	test.AssertEq(t, c.Path(), "")
+
+	data, err = c.Output(strings.NewReader("abcd"), process.Stdout, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, string(data), "abcd")
+	test.AssertEq(t, c.Truncated(), false)
+}
+
+func TestCaptureError(t *testing.T) {
+	_, err := process.Exec(&process.ExecOptions{
+		Command: []string{"head", "-c", "1048576", "/dev/zero"},
+		Stdout:  process.NewCapture(1024, process.CaptureError).Output,
+		Trusted: true,
+	})
+	if !errors.Is(err, process.ErrOutputLimit) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestCaptureSpill(t *testing.T) {
+	c := process.NewCapture(1024, process.CaptureSpill)
+	defer func() {
+		test.AssertEq(t, c.Close(), nil)
+	}()
+
+	input := bytes.Repeat([]byte("0123456789abcdef"), 16384)
+	data, err := c.Output(bytes.NewReader(input), process.Stdout, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := append(append([]byte{}, input[:1024]...), process.DefaultCaptureMarker...)
+	test.AssertEq(t, bytes.Equal(data, expected), true)
+	test.AssertNe(t, c.Path(), "")
+
+	spilled, err := iofs.ReadFile(c.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, bytes.Equal(spilled, input), true)
+
+	path := c.Path()
+	test.AssertEq(t, c.Close(), nil)
+
+	exists, err := iofs.Exists(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, exists, false)
+}
+
+func TestCapturePolicy(t *testing.T) {
+	c := process.NewCapture(1024, process.CaptureTruncate)
+	c.Policy = &stringx.Policy{UTF8: true, Sequences: stringx.SequenceStrip}
+
+	reader := iotest.OneByteReader(strings.NewReader("\x1b[1mé\x1b[0m\n"))
+	data, err := c.Output(reader, process.Stdout, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, string(data), "é\n")
+
+	_, err = c.Output(strings.NewReader("é"), process.Stdout, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err = process.CaptureOutput(strings.NewReader("\x1b[1m\t"), process.Stdout, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, string(data), "_[1m_")
+
+	_, err = process.CaptureOutputWith(stringx.StrictPolicy)(strings.NewReader("\x1b[1m"), process.Stdout, false)
+	test.AssertEq(t, errors.Is(err, stringx.ErrInvalidCharacter), true)
+
+	data, err = process.CaptureOutputWith(c.Policy)(strings.NewReader("\x1b[1m"), process.Stdout, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, len(data), 0)
+}
+
+func TestCaptureBusy(t *testing.T) {
+	c := process.NewCapture(1024, process.CaptureTruncate)
+	r, w := io.Pipe()
+
+	type result struct {
+		data []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		data, err := c.Output(r, process.Stdout, false)
+		done <- result{data, err}
+	}()
+
+	_, err := io.WriteString(w, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Size() doesn't block while the output is captured.
+	for c.Size() != 3 {
+		time.Sleep(time.Millisecond)
+	}
+
+	_, err = c.Output(strings.NewReader("bar"), process.Stderr, false)
+	test.AssertNe(t, err, nil)
+	test.AssertNe(t, c.Close(), nil)
+
+	test.AssertEq(t, w.Close(), nil)
+	res := <-done
+	test.AssertEq(t, res.err, nil)
+	test.AssertEq(t, string(res.data), "foo")
+	test.AssertEq(t, c.Close(), nil)
+}
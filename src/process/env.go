@@ -0,0 +1,137 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultEnvDeny are patterns for environment variables that commonly hold
+// credentials or give access to agents.
+var DefaultEnvDeny = []string{
+	"SSH_AUTH_SOCK",
+	"SSH_AGENT_PID",
+	"GPG_AGENT_INFO",
+	"KRB5CCNAME",
+	"DBUS_SESSION_BUS_ADDRESS",
+	"AWS_*",
+	"AZURE_*",
+	"GOOGLE_APPLICATION_CREDENTIALS",
+	"DOCKER_AUTH_CONFIG",
+	"*TOKEN*",
+	"*SECRET*",
+	"*PASSWORD*",
+	"*PASSWD*",
+	"*CREDENTIAL*",
+	"*API_KEY*",
+	"*ACCESS_KEY*",
+	"*PRIVATE_KEY*",
+}
+
+// DefaultEnvPolicy is used for children that are started without an
+// explicit environment.
+var DefaultEnvPolicy = &EnvPolicy{Deny: DefaultEnvDeny}
+
+// cleanEnv are the variables that are kept in clean mode.
+var cleanEnv = []string{"PATH", "HOME", "LANG"}
+
+// EnvPolicy filters the environment of a child.  Allow and Deny are lists of
+// variable names that may contain path.Match() patterns.  If Clean is set,
+// only PATH, HOME and LANG are kept in addition to the allowed variables.
+// Otherwise, every variable is kept if Allow is empty.  Deny takes
+// precedence over Allow, and Set forces variables to the given values
+// regardless of the other rules.
+//
+// A zero EnvPolicy keeps the environment as-is.
+type EnvPolicy struct {
+	Allow []string
+	Deny  []string
+	Set   map[string]string
+	Clean bool
+}
+
+// Apply returns the entries in environ that are permitted by the policy.
+func (p *EnvPolicy) Apply(environ []string) []string {
+	env := []string{}
+	removed := []string{}
+
+	for _, entry := range environ {
+		name, _, _ := strings.Cut(entry, "=")
+		if _, ok := p.Set[name]; ok {
+			continue
+		}
+
+		if p.permits(name) {
+			env = append(env, entry)
+		} else {
+			removed = append(removed, name)
+		}
+	}
+
+	names := []string{}
+	for name := range p.Set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		env = append(env, fmt.Sprintf("%s=%s", name, p.Set[name]))
+	}
+
+	log.Debugf(
+		"env: allow=%s deny=%s set=%s clean=%t removed=%s",
+		strings.Join(p.Allow, ","),
+		strings.Join(p.Deny, ","),
+		strings.Join(names, ","),
+		p.Clean,
+		strings.Join(removed, ","),
+	)
+	return env
+}
+
+func (p *EnvPolicy) permits(name string) bool {
+	if matchEnv(p.Deny, name) {
+		return false
+	}
+
+	if p.Clean {
+		return matchEnv(cleanEnv, name) || matchEnv(p.Allow, name)
+	}
+
+	return len(p.Allow) == 0 || matchEnv(p.Allow, name)
+}
+
+func matchEnv(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		ok, err := path.Match(pattern, name)
+		if err != nil {
+			log.Debugf("env: invalid pattern %s: %v", pattern, err)
+			continue
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Environ returns the environment for a child.  An explicit env is used
+// as-is unless a policy is also given.  Otherwise, the policy, or
+// DefaultEnvPolicy if it's nil, is applied to the current environment.
+func Environ(env []string, policy *EnvPolicy) []string {
+	if env == nil {
+		env = os.Environ()
+		if policy == nil {
+			policy = DefaultEnvPolicy
+		}
+	}
+
+	if policy == nil {
+		return env
+	}
+	return policy.Apply(env)
+}
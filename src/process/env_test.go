@@ -0,0 +1,73 @@
+package process_test
+
+import (
+	"testing"
+
+	"github.com/illikainen/go-utils/src/process"
+	"github.com/illikainen/go-utils/src/test"
+)
+
+var environ = []string{
+	"PATH=/usr/bin",
+	"HOME=/home/user",
+	"LANG=C.UTF-8",
+	"TERM=xterm",
+	"SSH_AUTH_SOCK=/tmp/agent",
+	"GITHUB_TOKEN=secret",
+	"AWS_REGION=eu-north-1",
+	"GOPATH=/home/user/go",
+}
+
+func TestEnvPolicyZero(t *testing.T) {
+	policy := &process.EnvPolicy{}
+	test.AssertEq(t, policy.Apply(environ), environ)
+}
+
+func TestEnvPolicyDefault(t *testing.T) {
+	test.AssertEq(t, process.DefaultEnvPolicy.Apply(environ), []string{
+		"PATH=/usr/bin",
+		"HOME=/home/user",
+		"LANG=C.UTF-8",
+		"TERM=xterm",
+		"GOPATH=/home/user/go",
+	})
+}
+
+func TestEnvPolicyAllowDeny(t *testing.T) {
+	policy := &process.EnvPolicy{
+		Allow: []string{"GO*", "AWS_*", "TERM"},
+		Deny:  []string{"AWS_*"},
+	}
+	test.AssertEq(t, policy.Apply(environ), []string{"TERM=xterm", "GOPATH=/home/user/go"})
+}
+
+func TestEnvPolicyClean(t *testing.T) {
+	policy := &process.EnvPolicy{
+		Allow: []string{"TERM"},
+		Set:   map[string]string{"LANG": "C", "FOO": "bar"},
+		Clean: true,
+	}
+	test.AssertEq(t, policy.Apply(environ), []string{
+		"PATH=/usr/bin",
+		"HOME=/home/user",
+		"TERM=xterm",
+		"FOO=bar",
+		"LANG=C",
+	})
+}
+
+func TestEnviron(t *testing.T) {
+	t.Setenv("GO_UTILS_TEST_TOKEN", "secret")
+	t.Setenv("GO_UTILS_TEST_VALUE", "value")
+
+	out, err := process.Exec(&process.ExecOptions{
+		Command: []string{"sh", "-c", "echo ${GO_UTILS_TEST_TOKEN:-unset} $GO_UTILS_TEST_VALUE"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, string(out.Stdout), "unset value\n")
+
+	env := []string{"GO_UTILS_TEST_TOKEN=explicit"}
+	test.AssertEq(t, process.Environ(env, nil), env)
+}
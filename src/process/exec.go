@@ -1,26 +1,32 @@
 package process
 
 import (
+	"context"
 	"io"
+	"os"
 	"os/exec"
 	"os/user"
-	"strings"
-
-	"github.com/illikainen/go-utils/src/errorx"
+	"syscall"
+	"time"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
-	"golang.org/x/sync/errgroup"
 )
 
 type ExecOptions struct {
 	Command         []string
 	Env             []string
+	EnvPolicy       *EnvPolicy
 	Dir             string
 	Become          string
 	Stdin           io.Reader
 	Stdout          OutputFunc
 	Stderr          OutputFunc
+	ExtraFiles      []*os.File
+	PTY             *PTYOptions
+	Limits          *ResourceLimits
+	GracePeriod     time.Duration
+	WaitDelay       time.Duration
 	IgnoreExitError bool
 	Trusted         bool
 }
@@ -30,92 +36,68 @@ const (
 	Stderr
 )
 
+// ExecOutput is the result of a child.  Duration is the wall-clock time from
+// the start of the child until it was reaped, and Usage is its resource
+// usage.
 type ExecOutput struct {
 	Stdout   []byte
 	Stderr   []byte
 	ExitCode int
+	Duration time.Duration
+	Usage    *Usage
 }
 
-func Exec(opts *ExecOptions) (*ExecOutput, error) {
-	args := opts.Command
-	if opts.Become != "" {
-		esc, err := Become(opts.Become)
-		if err != nil {
-			return nil, err
-		}
+// DefaultGracePeriod is the time a child is given to exit after SIGTERM
+// before it's killed with SIGKILL.
+const DefaultGracePeriod = 5 * time.Second
 
-		args = append(esc, args...)
-	}
-
-	cmd := exec.Command(args[0], args[1:]...) // #nosec G204
-	cmd.Env = opts.Env
-	cmd.Dir = opts.Dir
-	cmd.Stdin = opts.Stdin
+// DefaultWaitDelay is the time the output of a child is read after it has
+// exited.  Descendants that detach from the child may keep its stdout and
+// stderr open indefinitely, so the output is considered complete once the
+// delay expires.
+const DefaultWaitDelay = 5 * time.Second
 
-	out := &ExecOutput{ExitCode: 1}
-	group := errgroup.Group{}
+func Exec(opts *ExecOptions) (*ExecOutput, error) {
+	return ExecContext(context.Background(), opts)
+}
 
-	stdoutPipe, err := cmd.StdoutPipe()
+// ExecContext is like Exec, but the child is terminated if ctx is done before
+// it exits.  The child is placed in a new process group that's sent SIGTERM
+// followed by SIGKILL after opts.GracePeriod.  The returned error wraps
+// ctx.Err(), so timeouts can be identified with context.DeadlineExceeded.
+func ExecContext(ctx context.Context, opts *ExecOptions) (*ExecOutput, error) {
+	p, err := newProcess(ctx, opts)
 	if err != nil {
-		return nil, errors.WithStack(err)
-	}
-
-	stdoutFunc := opts.Stdout
-	if stdoutFunc == nil {
-		stdoutFunc = CaptureOutput
+		return nil, err
 	}
 
-	group.Go(func() error {
-		out.Stdout, err = stdoutFunc(stdoutPipe, Stdout, opts.Trusted)
-		return err
-	})
-
-	stderrPipe, err := cmd.StderrPipe()
+	err = p.start(nil)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, err
 	}
 
-	stderrFunc := opts.Stderr
-	if stderrFunc == nil {
-		stderrFunc = CaptureOutput
-	}
-
-	group.Go(func() error {
-		out.Stderr, err = stderrFunc(stderrPipe, Stderr, opts.Trusted)
-		return err
-	})
-
-	log.Tracef("exec: %s", strings.Join(cmd.Args, " "))
-	err = cmd.Start()
-	if err != nil {
-		// XXX: what to do with the goroutine errgroup here?
-		return nil, errors.WithStack(err)
-	}
+	return p.Wait()
+}
 
-	err = group.Wait()
+func terminate(cmd *exec.Cmd, grace time.Duration, done <-chan struct{}) {
+	log.Debugf("exec: terminating %d", cmd.Process.Pid)
+	err := signal(cmd, syscall.SIGTERM)
 	if err != nil {
-		return nil, errorx.Join(errors.WithStack(err), cmd.Wait())
+		log.Debugf("exec: %v", err)
 	}
 
-	err = cmd.Wait()
-	if err != nil {
-		var exitErr *exec.ExitError
-		if errors.As(err, &exitErr) {
-			out.ExitCode = exitErr.ExitCode()
-
-			if opts.IgnoreExitError {
-				return out, nil
-			}
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
 
-			if len(out.Stderr) > 0 {
-				return nil, errors.Errorf("%s", out.Stderr)
-			}
+	select {
+	case <-done:
+	case <-timer.C:
+		log.Debugf("exec: killing %d", cmd.Process.Pid)
+		err := signal(cmd, os.Kill)
+		if err != nil {
+			log.Debugf("exec: %v", err)
 		}
-		return nil, errors.WithStack(err)
 	}
-
-	out.ExitCode = 0
-	return out, nil
 }
 
 func Become(username string) ([]string, error) {
@@ -0,0 +1,32 @@
+//go:build !unix
+
+package process
+
+import (
+	"os"
+	"os/exec"
+)
+
+func setProcessGroup(*exec.Cmd) {
+}
+
+// signal kills the child because other signals aren't supported on this
+// platform.
+func signal(cmd *exec.Cmd, _ os.Signal) error {
+	err := cmd.Process.Kill()
+	if err == os.ErrProcessDone {
+		return nil
+	}
+	return err
+}
+
+// exitSignal returns nil because signals aren't supported on this platform.
+func exitSignal(*os.ProcessState) (os.Signal, bool) {
+	return nil, false
+}
+
+// maxRSS returns 0 because the resident set size is unavailable on this
+// platform.
+func maxRSS(*os.ProcessState) int64 {
+	return 0
+}
@@ -0,0 +1,93 @@
+package process_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/illikainen/go-utils/src/process"
+	"github.com/illikainen/go-utils/src/test"
+
+	"github.com/pkg/errors"
+)
+
+func TestExec(t *testing.T) {
+	out, err := process.Exec(&process.ExecOptions{
+		Command: []string{"sh", "-c", "echo foo; echo bar >&2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.AssertEq(t, string(out.Stdout), "foo\n")
+	test.AssertEq(t, string(out.Stderr), "bar\n")
+	test.AssertEq(t, out.ExitCode, 0)
+	test.AssertNe(t, out.Usage, nil)
+	test.AssertEq(t, out.Duration > 0, true)
+}
+
+func TestExecExitError(t *testing.T) {
+	_, err := process.Exec(&process.ExecOptions{
+		Command: []string{"sh", "-c", "echo failed >&2; exit 3"},
+	})
+
+	var exitErr *process.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	test.AssertEq(t, exitErr.Command, []string{"sh", "-c", "echo failed >&2; exit 3"})
+	test.AssertEq(t, exitErr.ExitCode, 3)
+	test.AssertEq(t, exitErr.Signal, nil)
+	test.AssertEq(t, string(exitErr.Stderr), "failed\n")
+	test.AssertEq(t, exitErr.Error(), "sh: exit status 3: failed")
+}
+
+func TestExecExitErrorSignal(t *testing.T) {
+	_, err := process.Exec(&process.ExecOptions{
+		Command: []string{"sh", "-c", "head -c 8192 /dev/zero >&2; kill -KILL $$"},
+	})
+
+	var exitErr *process.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	test.AssertEq(t, exitErr.ExitCode, -1)
+	test.AssertEq(t, exitErr.Signal, os.Signal(syscall.SIGKILL))
+	test.AssertEq(t, len(exitErr.Stderr), process.MaxExitErrorStderr)
+	test.AssertEq(t, strings.Contains(exitErr.Error(), "signal: killed"), true)
+}
+
+func TestExecContextTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := process.ExecContext(ctx, &process.ExecOptions{
+		Command:     []string{"sh", "-c", "trap '' TERM; sleep 10 & wait"},
+		GracePeriod: 100 * time.Millisecond,
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("process group wasn't killed")
+	}
+}
+
+func TestExecContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := process.ExecContext(ctx, &process.ExecOptions{
+		Command: []string{"true"},
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+//go:build unix
+
+package process
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// signal sends sig to the process group of the child if it has its own, and
+// otherwise to the child.  Children in a new session are the leaders of
+// their own process group.
+func signal(cmd *exec.Cmd, sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+	if ok && cmd.SysProcAttr != nil && (cmd.SysProcAttr.Setpgid || cmd.SysProcAttr.Setsid) {
+		err := syscall.Kill(-cmd.Process.Pid, s)
+		if err == nil || err == syscall.ESRCH {
+			return nil
+		}
+		return err
+	}
+
+	err := cmd.Process.Signal(sig)
+	if err == os.ErrProcessDone {
+		return nil
+	}
+	return err
+}
+
+// exitSignal returns the signal that terminated the child, if any, and
+// whether it dumped core.
+func exitSignal(state *os.ProcessState) (os.Signal, bool) {
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return nil, false
+	}
+	return status.Signal(), status.CoreDump()
+}
+
+// maxRSS returns the maximum resident set size of the child in bytes.
+func maxRSS(state *os.ProcessState) int64 {
+	usage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0
+	}
+
+	// The size is in bytes on macOS and in kilobytes elsewhere.
+	if runtime.GOOS == "darwin" {
+		return int64(usage.Maxrss)
+	}
+	return int64(usage.Maxrss) * 1024
+}
@@ -0,0 +1,77 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// MaxExitErrorStderr is the number of bytes at the end of stderr that are
+// kept in an ExitError.
+const MaxExitErrorStderr = 4096
+
+// Usage is the resource usage of a child.  MaxRSS is in bytes and is zero
+// on platforms where it's unavailable.
+type Usage struct {
+	UserTime   time.Duration
+	SystemTime time.Duration
+	MaxRSS     int64
+}
+
+func newUsage(state *os.ProcessState) *Usage {
+	return &Usage{
+		UserTime:   state.UserTime(),
+		SystemTime: state.SystemTime(),
+		MaxRSS:     maxRSS(state),
+	}
+}
+
+// ExitError is returned if a child exits with a non-zero status or is
+// terminated by a signal.  ExitCode is -1 if the child was terminated by a
+// signal.  Stderr is truncated to the last MaxExitErrorStderr bytes.
+type ExitError struct {
+	Command  []string
+	ExitCode int
+	Signal   os.Signal
+	CoreDump bool
+	Duration time.Duration
+	Usage    *Usage
+	Stderr   []byte
+}
+
+func newExitError(args []string, state *os.ProcessState, duration time.Duration, stderr []byte) *ExitError {
+	sig, core := exitSignal(state)
+
+	if len(stderr) > MaxExitErrorStderr {
+		stderr = stderr[len(stderr)-MaxExitErrorStderr:]
+	}
+
+	return &ExitError{
+		Command:  args,
+		ExitCode: state.ExitCode(),
+		Signal:   sig,
+		CoreDump: core,
+		Duration: duration,
+		Usage:    newUsage(state),
+		Stderr:   append([]byte{}, stderr...),
+	}
+}
+
+func (e *ExitError) Error() string {
+	status := fmt.Sprintf("exit status %d", e.ExitCode)
+	if e.Signal != nil {
+		status = fmt.Sprintf("signal: %s", e.Signal)
+		if e.CoreDump {
+			status += " (core dumped)"
+		}
+	}
+
+	msg := fmt.Sprintf("%s: %s", e.Command[0], status)
+
+	stderr := strings.TrimSpace(string(e.Stderr))
+	if stderr != "" {
+		msg += ": " + stderr
+	}
+	return msg
+}
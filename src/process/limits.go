@@ -0,0 +1,58 @@
+package process
+
+import (
+	"fmt"
+	"time"
+)
+
+// ResourceLimits caps the resources available to a child process.  Zero
+// values are unlimited.
+//
+// Memory, CPUTime, Files and FileSize are applied as rlimits with
+// setrlimit(2) by a re-exec of the current executable before the target
+// program is executed, so DispatchLimits() must be called early in main().
+// The re-executed process also moves itself into a transient cgroup v2 where
+// Memory, CPUQuota and Processes are enforced with memory.max, cpu.max and
+// pids.max.  The cgroup is created in a delegated subtree where the required
+// controllers can be enabled, and starting the child fails if CPUQuota or
+// Processes is set and the cgroup can't be created.
+// Processes is only enforced with cgroups because RLIMIT_NPROC counts every
+// process that belongs to the user rather than the children of a process.
+type ResourceLimits struct {
+	// Memory is applied as RLIMIT_AS and, if possible, as memory.max.
+	// Exceeding RLIMIT_AS makes allocations fail in the child, which
+	// usually terminates with an ordinary error rather than a
+	// ResourceLimitError.  A ResourceLimitError is only returned if the
+	// child was killed by the OOM killer of the transient cgroup.
+	Memory    uint64
+	CPUTime   time.Duration
+	CPUQuota  float64
+	Files     uint64
+	FileSize  uint64
+	Processes uint64
+
+	// Cgroup is the cgroup v2 directory under which the transient cgroup
+	// is created.  It defaults to the cgroup of the current process, but
+	// cgroup v2 only allows controllers to be enabled below a cgroup without
+	// processes of its own, so this should usually point to a delegated
+	// subtree.
+	Cgroup string
+}
+
+// ResourceLimitError is returned if a child was terminated because it
+// exceeded a resource limit.
+type ResourceLimitError struct {
+	Resource string
+}
+
+func (e *ResourceLimitError) Error() string {
+	return fmt.Sprintf("resource limit exceeded: %s", e.Resource)
+}
+
+func (l *ResourceLimits) needsCgroup() bool {
+	return l.Memory > 0 || l.CPUQuota > 0 || l.Processes > 0
+}
+
+func (l *ResourceLimits) requiresCgroup() bool {
+	return l.CPUQuota > 0 || l.Processes > 0
+}
@@ -0,0 +1,358 @@
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/illikainen/go-utils/src/errorx"
+	"github.com/illikainen/go-utils/src/iofs"
+	"github.com/illikainen/go-utils/src/seq"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const limitsEnv = "GO_PROCESS_LIMITS"
+const cgroupRoot = "/sys/fs/cgroup"
+
+var cgroupCounter uint64
+
+type limiter struct {
+	limits *ResourceLimits
+	cgroup string
+}
+
+type shimLimits struct {
+	Rlimits map[int]uint64 `json:"rlimits"`
+	Cgroup  string         `json:"cgroup"`
+}
+
+var limitsEnabled atomic.Bool
+
+// DispatchLimits applies the resource limits and execs the target program
+// in children that were started with ResourceLimits.  It returns
+// immediately in other processes.  It must be called early in main() before
+// ResourceLimits can be used, because Go can't run code between fork() and
+// exec() in the child.  Instead, the current executable is started with the
+// limits in the environment, and it applies them to itself here before it
+// execs the target program.
+func DispatchLimits() {
+	value, ok := os.LookupEnv(limitsEnv)
+	if !ok {
+		limitsEnabled.Store(true)
+		return
+	}
+
+	err := execLimited(value)
+	fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[0], err)
+	os.Exit(127) // revive:disable-line
+}
+
+func execLimited(value string) error {
+	err := os.Unsetenv(limitsEnv)
+	if err != nil {
+		return err
+	}
+
+	if len(os.Args) < 3 {
+		return errors.Errorf("invalid arguments")
+	}
+
+	shim := shimLimits{}
+	err = json.Unmarshal([]byte(value), &shim)
+	if err != nil {
+		return err
+	}
+
+	if shim.Cgroup != "" {
+		procs := filepath.Join(shim.Cgroup, "cgroup.procs")
+		err := os.WriteFile(procs, []byte(strconv.Itoa(os.Getpid())), 0600)
+		if err != nil {
+			return err
+		}
+	}
+
+	for resource, value := range shim.Rlimits {
+		rlim := &unix.Rlimit{Cur: value, Max: value}
+		if resource == unix.RLIMIT_CPU {
+			// The soft limit raises SIGXCPU and the hard limit
+			// raises SIGKILL.  The grace period gives the child a
+			// chance to terminate in a more graceful manner.
+			rlim.Max++
+		}
+
+		err := unix.Setrlimit(resource, rlim)
+		if err != nil {
+			return errors.Wrapf(err, "setrlimit %d", resource)
+		}
+	}
+
+	return syscall.Exec(os.Args[1], os.Args[2:], os.Environ()) // #nosec G204
+}
+
+func prepareLimits(limits *ResourceLimits, cmd *exec.Cmd) (*limiter, error) {
+	if limits == nil {
+		return nil, nil
+	}
+
+	if cmd.Err != nil {
+		return nil, cmd.Err
+	}
+
+	if !limitsEnabled.Load() {
+		return nil, errors.Errorf("resource limits require process.DispatchLimits() in main()")
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	l := &limiter{limits: limits}
+	shim := shimLimits{Rlimits: map[int]uint64{}}
+
+	for resource, value := range map[int]uint64{
+		unix.RLIMIT_AS:     limits.Memory,
+		unix.RLIMIT_NOFILE: limits.Files,
+		unix.RLIMIT_FSIZE:  limits.FileSize,
+	} {
+		if value > 0 {
+			shim.Rlimits[resource] = value
+		}
+	}
+	if limits.CPUTime > 0 {
+		shim.Rlimits[unix.RLIMIT_CPU] = uint64(math.Ceil(limits.CPUTime.Seconds()))
+	}
+
+	if limits.needsCgroup() {
+		cgroup, err := createCgroup(limits)
+		if err != nil {
+			if limits.requiresCgroup() {
+				return nil, errors.Wrap(err, "unable to enforce cgroup limits")
+			}
+			log.Debugf("memory is only limited with RLIMIT_AS: %v", err)
+		}
+		l.cgroup = cgroup
+		shim.Cgroup = cgroup
+	}
+
+	value, err := json.Marshal(shim)
+	if err != nil {
+		return nil, errorx.Join(err, l.close())
+	}
+
+	cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", limitsEnv, value))
+	cmd.Args = append([]string{self, cmd.Path}, cmd.Args...)
+	cmd.Path = self
+	return l, nil
+}
+
+func (l *limiter) check(state *os.ProcessState) error {
+	if l == nil {
+		return nil
+	}
+
+	if l.cgroup != "" {
+		n, err := cgroupEvent(filepath.Join(l.cgroup, "memory.events"), "oom_kill")
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return &ResourceLimitError{Resource: "memory"}
+		}
+
+		n, err = cgroupEvent(filepath.Join(l.cgroup, "pids.events"), "max")
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return &ResourceLimitError{Resource: "processes"}
+		}
+	}
+
+	if state == nil {
+		return nil
+	}
+
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return nil
+	}
+
+	switch status.Signal() {
+	case syscall.SIGXCPU:
+		return &ResourceLimitError{Resource: "cpu"}
+	case syscall.SIGXFSZ:
+		return &ResourceLimitError{Resource: "file size"}
+	case syscall.SIGKILL:
+		if l.limits.CPUTime > 0 && state.UserTime()+state.SystemTime() >= l.limits.CPUTime {
+			return &ResourceLimitError{Resource: "cpu"}
+		}
+	}
+
+	return nil
+}
+
+func (l *limiter) close() error {
+	if l == nil || l.cgroup == "" {
+		return nil
+	}
+
+	// Kill any lingering descendants so that the cgroup can be removed.
+	kill := filepath.Join(l.cgroup, "cgroup.kill")
+	exists, err := iofs.Exists(kill)
+	if err != nil {
+		return err
+	}
+	if exists {
+		err := os.WriteFile(kill, []byte("1"), 0600)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = os.Remove(l.cgroup)
+	if err != nil {
+		log.Debugf("unable to remove %s: %v", l.cgroup, err)
+	}
+	return nil
+}
+
+func createCgroup(limits *ResourceLimits) (path string, err error) {
+	parent := limits.Cgroup
+	if parent == "" {
+		parent, err = currentCgroup()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = enableControllers(parent, limits)
+	if err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("go-utils-%d-%d", os.Getpid(), atomic.AddUint64(&cgroupCounter, 1))
+	path = filepath.Join(parent, name)
+
+	err = os.Mkdir(path, 0700)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err != nil {
+			err = errorx.Join(err, os.Remove(path))
+			path = ""
+		}
+	}()
+
+	values := map[string]string{}
+	if limits.Memory > 0 {
+		values["memory.max"] = strconv.FormatUint(limits.Memory, 10)
+	}
+	if limits.Processes > 0 {
+		values["pids.max"] = strconv.FormatUint(limits.Processes, 10)
+	}
+	if limits.CPUQuota > 0 {
+		period := 100000
+		values["cpu.max"] = fmt.Sprintf("%d %d", int(limits.CPUQuota*float64(period)), period)
+	}
+
+	for file, value := range values {
+		err := os.WriteFile(filepath.Join(path, file), []byte(value), 0600)
+		if err != nil {
+			return "", errors.Wrapf(err, "%s", file)
+		}
+		log.Debugf("cgroup: %s: %s=%s", path, file, value)
+	}
+
+	return path, nil
+}
+
+// enableControllers enables the controllers that are needed for the limits
+// in the subtree of parent.  Note that cgroup v2 doesn't allow controllers
+// to be enabled for the children of a cgroup that has processes of its own,
+// so this typically fails for the cgroup of the current process unless it is
+// the root of a delegated subtree.  Use ResourceLimits.Cgroup in that case.
+func enableControllers(parent string, limits *ResourceLimits) error {
+	controllers := []string{}
+	if limits.Memory > 0 {
+		controllers = append(controllers, "memory")
+	}
+	if limits.Processes > 0 {
+		controllers = append(controllers, "pids")
+	}
+	if limits.CPUQuota > 0 {
+		controllers = append(controllers, "cpu")
+	}
+
+	path := filepath.Join(parent, "cgroup.subtree_control")
+	data, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		return err
+	}
+
+	enabled := strings.Fields(string(data))
+	missing := []string{}
+	for _, controller := range controllers {
+		if !seq.Contains(enabled, controller) {
+			missing = append(missing, "+"+controller)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	err = os.WriteFile(path, []byte(strings.Join(missing, " ")), 0600)
+	if err != nil {
+		return errors.Wrapf(err, "%s: unable to enable %s", path, strings.Join(missing, " "))
+	}
+	return nil
+}
+
+func currentCgroup() (string, error) {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+
+	// The unified hierarchy is always represented as `0::<path>`.
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "0::") {
+			return filepath.Join(cgroupRoot, strings.TrimPrefix(line, "0::")), nil
+		}
+	}
+
+	return "", errors.Errorf("cgroup v2 is not available")
+}
+
+func cgroupEvent(path string, key string) (uint64, error) {
+	data, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == key {
+			return strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+
+	return 0, scanner.Err()
+}
@@ -0,0 +1,50 @@
+package process_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/illikainen/go-utils/src/process"
+	"github.com/illikainen/go-utils/src/test"
+
+	"github.com/pkg/errors"
+)
+
+func TestResourceLimitsCPU(t *testing.T) {
+	_, err := process.Exec(&process.ExecOptions{
+		Command: []string{"sh", "-c", "while :; do :; done"},
+		Limits:  &process.ResourceLimits{CPUTime: time.Second},
+	})
+
+	var limitErr *process.ResourceLimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	test.AssertEq(t, limitErr.Resource, "cpu")
+}
+
+func TestResourceLimitsFiles(t *testing.T) {
+	out, err := process.Exec(&process.ExecOptions{
+		Command: []string{"sh", "-c", "ulimit -n"},
+		Limits:  &process.ResourceLimits{Files: 42},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, string(out.Stdout), "42\n")
+}
+
+func TestResourceLimitsCgroup(t *testing.T) {
+	_, err := process.Exec(&process.ExecOptions{
+		Command: []string{"true"},
+		Limits: &process.ResourceLimits{
+			Processes: 10,
+			Cgroup:    filepath.Join(t.TempDir(), "missing"),
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "unable to enforce cgroup limits") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+//go:build !linux
+
+package process
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+type limiter struct{}
+
+// DispatchLimits is a no-op because resource limits are only supported on
+// Linux.
+func DispatchLimits() {}
+
+func prepareLimits(limits *ResourceLimits, _ *exec.Cmd) (*limiter, error) {
+	if limits == nil {
+		return nil, nil
+	}
+	return nil, errors.Errorf("resource limits are not supported on %s", runtime.GOOS)
+}
+
+func (l *limiter) check(*os.ProcessState) error {
+	return nil
+}
+
+func (l *limiter) close() error {
+	return nil
+}
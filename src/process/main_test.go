@@ -0,0 +1,13 @@
+package process_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/illikainen/go-utils/src/process"
+)
+
+func TestMain(m *testing.M) {
+	process.DispatchLimits()
+	os.Exit(m.Run())
+}
@@ -0,0 +1,106 @@
+package process
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/illikainen/go-utils/src/stringx"
+
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+)
+
+// maxLineLength is the longest line that's read by the Multiplexer.
+const maxLineLength = 1 << 20
+
+// Multiplexer writes the output of concurrent children line by line, with
+// every line prefixed by the label of the child.  Lines are written
+// atomically, so lines from different children never interleave.  Labels are
+// padded to the width of the longest label.
+//
+// If Merge is set, both stdout and stderr are written to Stdout in the order
+// the lines arrive.  Untrusted output is sanitized with Policy, or with
+// stringx.DefaultPolicy if it's nil.
+type Multiplexer struct {
+	Stdout io.Writer
+	Stderr io.Writer
+	Merge  bool
+	Policy *stringx.Policy
+
+	mu    sync.Mutex
+	width int
+}
+
+func NewMultiplexer() *Multiplexer {
+	return &Multiplexer{Stdout: os.Stdout, Stderr: os.Stderr}
+}
+
+// Output returns an OutputFunc that prefixes lines with label.  The label is
+// colorized with c unless it's nil.  The returned data is the same as for
+// TextOutput.
+func (m *Multiplexer) Output(label string, c *color.Color) OutputFunc {
+	m.mu.Lock()
+	if len(label) > m.width {
+		m.width = len(label)
+	}
+	m.mu.Unlock()
+
+	return func(reader io.Reader, src int, trusted bool) ([]byte, error) {
+		policy := m.Policy
+		if policy == nil {
+			policy = stringx.DefaultPolicy
+		}
+
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 4096), maxLineLength)
+		scanner.Split(bufio.ScanLines)
+
+		data := []byte{}
+		for scanner.Scan() {
+			line, err := sanitize(policy, scanner.Bytes(), trusted, "Multiplexer")
+			if err != nil {
+				return nil, err
+			}
+
+			err = m.writeLine(label, c, src, line)
+			if err != nil {
+				return nil, err
+			}
+
+			data = append(data, line...)
+			data = append(data, '\n')
+		}
+
+		return data, scanner.Err()
+	}
+}
+
+func (m *Multiplexer) writeLine(label string, c *color.Color, src int, line []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w := m.Stdout
+	if src != Stdout && !m.Merge {
+		w = m.Stderr
+	}
+
+	prefix := label + strings.Repeat(" ", m.width-len(label))
+	if c != nil {
+		prefix = c.Sprint(prefix)
+	}
+
+	str := fmt.Sprintf("%s | %s\n", prefix, line)
+	n, err := io.WriteString(w, str)
+	if err != nil {
+		return err
+	}
+
+	if n != len(str) {
+		return errors.Errorf("unexpected write, %d != %d", n, len(str))
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package process_test
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/illikainen/go-utils/src/process"
+	"github.com/illikainen/go-utils/src/stringx"
+	"github.com/illikainen/go-utils/src/test"
+
+	"github.com/fatih/color"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestMultiplexer(t *testing.T) {
+	buf := &bytes.Buffer{}
+	m := &process.Multiplexer{Stdout: buf, Merge: true}
+
+	group := errgroup.Group{}
+	for _, label := range []string{"a", "bbb"} {
+		output := m.Output(label, nil)
+		group.Go(func() error {
+			_, err := process.Exec(&process.ExecOptions{
+				Command: []string{"sh", "-c", "for i in $(seq 100); do echo out $i; echo err $i >&2; done"},
+				Stdout:  output,
+				Stderr:  output,
+			})
+			return err
+		})
+	}
+
+	err := group.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := stringx.SplitLines(buf.String())
+	test.AssertEq(t, len(lines), 400)
+
+	re := regexp.MustCompile(`^(a  |bbb) \| (out|err) [0-9]+$`)
+	for _, line := range lines {
+		test.AssertEq(t, re.MatchString(line), true)
+	}
+}
+
+func TestMultiplexerColor(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	m := &process.Multiplexer{Stdout: stdout, Stderr: stderr}
+
+	c := color.New(color.FgRed)
+	c.EnableColor()
+
+	out, err := process.Exec(&process.ExecOptions{
+		Command: []string{"sh", "-c", "echo foo; echo bar >&2"},
+		Stdout:  m.Output("x", c),
+		Stderr:  m.Output("y", nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.AssertEq(t, stdout.String(), "\x1b[31mx\x1b[0m | foo\n")
+	test.AssertEq(t, stderr.String(), "y | bar\n")
+	test.AssertEq(t, string(out.Stdout), "foo\n")
+	test.AssertEq(t, strings.TrimSpace(string(out.Stderr)), "bar")
+}
@@ -2,11 +2,9 @@ package process
 
 import (
 	"bufio"
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
-	"math"
 	"os"
 
 	"github.com/illikainen/go-utils/src/logging"
@@ -18,9 +16,8 @@ import (
 
 type OutputFunc = func(io.Reader, int, bool) ([]byte, error)
 
-// FIXME: do something about the blocking behavior when io.Copy()ing from a
-// pipe to a *bytes.Buffer in ByteOutput() so that we don't need this function
-// when shipping data from one process to another.
+// UnsafeByteOutput copies the output without any sanitization.  Use
+// Pipeline() to ship data from one process to another.
 func UnsafeByteOutput(reader io.Reader, src int, _ bool) ([]byte, error) {
 	w := os.Stdout
 	if src != Stdout {
@@ -31,100 +28,133 @@ func UnsafeByteOutput(reader io.Reader, src int, _ bool) ([]byte, error) {
 	return nil, err
 }
 
+// ByteOutput writes the output after it has been read in its entirety.
+// Untrusted output is sanitized with stringx.DefaultPolicy.
 func ByteOutput(reader io.Reader, src int, trusted bool) ([]byte, error) {
-	buf := &bytes.Buffer{}
-	n, err := io.Copy(buf, reader)
-	if err != nil {
-		return nil, err
-	}
-
-	if !trusted && !bytes.Equal(stringx.Sanitize(buf.Bytes()), buf.Bytes()) {
-		return nil, errors.Errorf("ByteOutput(): invalid data")
-	}
+	return ByteOutputWith(stringx.DefaultPolicy)(reader, src, trusted)
+}
 
-	w := os.Stdout
-	if src != Stdout {
-		w = os.Stderr
-	}
+// ByteOutputWith is like ByteOutput, but untrusted output is sanitized with
+// policy.
+func ByteOutputWith(policy *stringx.Policy) OutputFunc {
+	return func(reader io.Reader, src int, trusted bool) ([]byte, error) {
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
 
-	m, err := io.Copy(w, buf)
-	if err != nil {
-		return nil, err
-	}
-	if n != m || m < math.MinInt || m > math.MaxInt {
-		return nil, errors.Errorf("ByteOutput(): invalid data size")
-	}
+		data, err = sanitize(policy, data, trusted, "ByteOutput")
+		if err != nil {
+			return nil, err
+		}
 
-	return buf.Bytes(), nil
-}
+		w := os.Stdout
+		if src != Stdout {
+			w = os.Stderr
+		}
 
-func CaptureOutput(reader io.Reader, _ int, trusted bool) ([]byte, error) {
-	scanner := bufio.NewScanner(reader)
-	scanner.Split(bufio.ScanBytes)
+		n, err := w.Write(data)
+		if err != nil {
+			return nil, err
+		}
+		if n != len(data) {
+			return nil, errors.Errorf("ByteOutput(): invalid data size")
+		}
 
-	data := []byte{}
-	for scanner.Scan() {
-		data = append(data, scanner.Bytes()...)
+		return data, nil
 	}
+}
 
-	err := scanner.Err()
-	if err != nil {
-		return nil, err
-	}
+// CaptureOutput keeps the complete output in memory.  Use Capture to bound
+// the memory usage for children that may produce large amounts of output.
+// Untrusted output is sanitized with stringx.DefaultPolicy.
+func CaptureOutput(reader io.Reader, src int, trusted bool) ([]byte, error) {
+	return CaptureOutputWith(stringx.DefaultPolicy)(reader, src, trusted)
+}
 
-	if !trusted && !bytes.Equal(stringx.Sanitize(data), data) {
-		return nil, errors.Errorf("CaptureOutput(): invalid data")
-	}
+// CaptureOutputWith is like CaptureOutput, but untrusted output is sanitized
+// with policy.
+func CaptureOutputWith(policy *stringx.Policy) OutputFunc {
+	return func(reader io.Reader, _ int, trusted bool) ([]byte, error) {
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
 
-	return data, nil
+		return sanitize(policy, data, trusted, "CaptureOutput")
+	}
 }
 
+// TextOutput writes the output line by line.  Untrusted output is sanitized
+// with stringx.DefaultPolicy.
 func TextOutput(reader io.Reader, src int, trusted bool) ([]byte, error) {
-	scanner := bufio.NewScanner(reader)
-	scanner.Split(bufio.ScanLines)
+	return TextOutputWith(stringx.DefaultPolicy)(reader, src, trusted)
+}
 
-	w := os.Stdout
-	if src != Stdout {
-		w = os.Stderr
-	}
+// TextOutputWith is like TextOutput, but untrusted output is sanitized with
+// policy.
+func TextOutputWith(policy *stringx.Policy) OutputFunc {
+	return func(reader io.Reader, src int, trusted bool) ([]byte, error) {
+		scanner := bufio.NewScanner(reader)
+		scanner.Split(bufio.ScanLines)
 
-	data := []byte{}
-	for scanner.Scan() {
-		chunk := scanner.Bytes()
-		if !trusted && !bytes.Equal(stringx.Sanitize(chunk), chunk) {
-			return nil, errors.Errorf("TextOutput(): invalid data")
+		w := os.Stdout
+		if src != Stdout {
+			w = os.Stderr
 		}
 
-		str := fmt.Sprintf("%s\n", chunk)
-		n, err := fmt.Fprintf(w, "%s", str)
-		if err != nil {
-			return nil, err
+		data := []byte{}
+		for scanner.Scan() {
+			chunk, err := sanitize(policy, scanner.Bytes(), trusted, "TextOutput")
+			if err != nil {
+				return nil, err
+			}
+
+			str := fmt.Sprintf("%s\n", chunk)
+			n, err := fmt.Fprintf(w, "%s", str)
+			if err != nil {
+				return nil, err
+			}
+
+			if n != len(str) {
+				return nil, errors.Errorf("unexpected write, %d != %d", n, len(str))
+			}
+
+			data = append(data, chunk...)
+			data = append(data, '\n')
 		}
 
-		if n != len(str) {
-			return nil, errors.Errorf("unexpected write, %d != %d", n, len(str))
-		}
-
-		data = append(data, chunk...)
-		data = append(data, '\n')
+		return data, scanner.Err()
 	}
+}
 
-	return data, scanner.Err()
+// LogrusOutput logs the output of a child that logs JSON with logrus.
+// Untrusted output is sanitized with stringx.DefaultPolicy.
+func LogrusOutput(reader io.Reader, src int, trusted bool) ([]byte, error) {
+	return LogrusOutputWith(stringx.DefaultPolicy)(reader, src, trusted)
 }
 
-func LogrusOutput(reader io.Reader, _ int, trusted bool) ([]byte, error) {
+// LogrusOutputWith is like LogrusOutput, but untrusted output is sanitized
+// with policy.
+func LogrusOutputWith(policy *stringx.Policy) OutputFunc {
+	return func(reader io.Reader, _ int, trusted bool) ([]byte, error) {
+		return logrusOutput(reader, policy, trusted)
+	}
+}
+
+func logrusOutput(reader io.Reader, policy *stringx.Policy, trusted bool) ([]byte, error) {
 	scanner := bufio.NewScanner(reader)
 	scanner.Split(bufio.ScanLines)
 
 	data := []byte{}
 	for scanner.Scan() {
-		chunk := scanner.Bytes()
-		if !trusted && !bytes.Equal(stringx.Sanitize(chunk), chunk) {
-			return nil, errors.Errorf("TextOutput(): invalid data")
+		chunk, err := sanitize(policy, scanner.Bytes(), trusted, "LogrusOutput")
+		if err != nil {
+			return nil, err
 		}
 
 		var fields log.Fields
-		err := json.Unmarshal(chunk, &fields)
+		err = json.Unmarshal(chunk, &fields)
 		if err != nil {
 			fields = log.Fields{}
 			fields["msg"] = string(chunk)
@@ -160,3 +190,16 @@ func LogrusOutput(reader io.Reader, _ int, trusted bool) ([]byte, error) {
 
 	return data, scanner.Err()
 }
+
+// sanitize sanitizes untrusted output with policy.
+func sanitize(policy *stringx.Policy, data []byte, trusted bool, name string) ([]byte, error) {
+	if trusted {
+		return data, nil
+	}
+
+	out, err := policy.Sanitize(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s(): invalid data", name)
+	}
+	return out, nil
+}
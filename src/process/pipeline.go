@@ -0,0 +1,119 @@
+package process
+
+import (
+	"context"
+	"os"
+
+	"github.com/illikainen/go-utils/src/errorx"
+
+	"github.com/pkg/errors"
+)
+
+type PipelineOutput struct {
+	Stdout []byte
+	Stages []*ExecOutput
+}
+
+func Pipeline(stages ...*ExecOptions) (*PipelineOutput, error) {
+	return PipelineContext(context.Background(), stages...)
+}
+
+// PipelineContext connects the stdout of each stage to the stdin of the next
+// stage, similar to `a | b | c` in a shell.  The data between stages is
+// streamed through OS pipes, so memory usage is bounded regardless of the
+// amount of data.  Only the first stage may have Stdin and only the last stage
+// may have Stdout.  Each stage has its own Stderr.
+//
+// Like with `set -o pipefail`, an error is returned if any stage fails unless
+// it has IgnoreExitError set.  The output is returned even if a stage failed
+// after it was started, with an entry in Stages for every stage.
+func PipelineContext(ctx context.Context, stages ...*ExecOptions) (*PipelineOutput, error) {
+	if len(stages) == 0 {
+		return nil, errors.Errorf("pipeline: no stages")
+	}
+
+	procs := []*Process{}
+	for i, opts := range stages {
+		if i > 0 && opts.Stdin != nil {
+			return nil, errors.Errorf("pipeline: stage %d: only the first stage can have stdin", i)
+		}
+
+		if opts.PTY != nil {
+			return nil, errors.Errorf("pipeline: stage %d: ptys aren't supported", i)
+		}
+
+		if i < len(stages)-1 && opts.Stdout != nil {
+			return nil, errors.Errorf("pipeline: stage %d: only the last stage can have stdout", i)
+		}
+
+		p, err := newProcess(ctx, opts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "pipeline: stage %d", i)
+		}
+		procs = append(procs, p)
+	}
+
+	var stdin *os.File
+	for i, p := range procs {
+		if stdin != nil {
+			p.cmd.Stdin = stdin
+		}
+
+		var r, w *os.File
+		var err error
+		if i < len(procs)-1 {
+			r, w, err = os.Pipe()
+			if err != nil {
+				return nil, errorx.Join(err, closeFile(stdin), abort(procs[:i]))
+			}
+		}
+
+		startErr := p.start(w)
+
+		// The pipes are inherited by the children, so the copies in
+		// this process must be closed for EOF to propagate.
+		closeErr := errorx.Join(closeFile(w), closeFile(stdin))
+		if startErr != nil || closeErr != nil {
+			started := procs[:i]
+			if startErr == nil {
+				started = procs[:i+1]
+			}
+			return nil, errorx.Join(errors.Wrapf(errorx.Join(startErr, closeErr), "pipeline: stage %d", i),
+				closeFile(r), abort(started))
+		}
+
+		stdin = r
+	}
+
+	out := &PipelineOutput{}
+	var errs error
+	for i, p := range procs {
+		stage, err := p.Wait()
+		if err != nil {
+			errs = errorx.Join(errs, errors.Wrapf(err, "pipeline: stage %d", i))
+			stage = p.failed()
+		}
+
+		out.Stages = append(out.Stages, stage)
+		if i == len(procs)-1 {
+			out.Stdout = stage.Stdout
+		}
+	}
+
+	return out, errs
+}
+
+func abort(procs []*Process) error {
+	var errs error
+	for _, p := range procs {
+		errs = errorx.Join(errs, p.abort())
+	}
+	return errs
+}
+
+func closeFile(f *os.File) error {
+	if f == nil {
+		return nil
+	}
+	return f.Close()
+}
@@ -0,0 +1,57 @@
+package process_test
+
+import (
+	"testing"
+
+	"github.com/illikainen/go-utils/src/process"
+	"github.com/illikainen/go-utils/src/test"
+
+	"github.com/pkg/errors"
+)
+
+func TestPipeline(t *testing.T) {
+	out, err := process.Pipeline(
+		&process.ExecOptions{Command: []string{"sh", "-c", "echo foo; echo bar; echo baz"}},
+		&process.ExecOptions{Command: []string{"grep", "ba"}},
+		&process.ExecOptions{Command: []string{"sh", "-c", "tr a-z A-Z; exit 3"}, IgnoreExitError: true},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.AssertEq(t, string(out.Stdout), "BAR\nBAZ\n")
+	test.AssertEq(t, len(out.Stages), 3)
+	test.AssertEq(t, out.Stages[0].ExitCode, 0)
+	test.AssertEq(t, out.Stages[1].ExitCode, 0)
+	test.AssertEq(t, out.Stages[2].ExitCode, 3)
+}
+
+func TestPipelineStreaming(t *testing.T) {
+	// 256 MiB would be noticeable if it were buffered between the stages.
+	out, err := process.Pipeline(
+		&process.ExecOptions{Command: []string{"head", "-c", "268435456", "/dev/zero"}},
+		&process.ExecOptions{Command: []string{"wc", "-c"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.AssertEq(t, string(out.Stdout), "268435456\n")
+}
+
+func TestPipelineFailure(t *testing.T) {
+	out, err := process.Pipeline(
+		&process.ExecOptions{Command: []string{"sh", "-c", "echo foo >&2; exit 2"}},
+		&process.ExecOptions{Command: []string{"cat"}},
+	)
+	test.AssertNe(t, err, nil)
+
+	var exitErr *process.ExitError
+	test.AssertEq(t, errors.As(err, &exitErr), true)
+	test.AssertEq(t, exitErr.ExitCode, 2)
+
+	test.AssertEq(t, len(out.Stages), 2)
+	test.AssertEq(t, out.Stages[0].ExitCode, 2)
+	test.AssertEq(t, string(out.Stages[0].Stderr), "foo\n")
+	test.AssertEq(t, out.Stages[1].ExitCode, 0)
+}
@@ -0,0 +1,182 @@
+package process
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/illikainen/go-utils/src/errorx"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PTYOptions runs a child in a pseudo-terminal.  The stdin, stdout and
+// stderr of the child are connected to the terminal, so everything that the
+// child writes is passed to the Stdout OutputFunc.  Output processing is
+// disabled in the terminal to keep newlines as-is, but the output is
+// otherwise checked like the output of pipes.
+//
+// The size of the terminal follows the terminal of the current process if
+// stdin is a terminal, and Rows and Cols are used otherwise.  If Raw is set,
+// the terminal of the current process is put in raw mode until the child
+// exits.
+type PTYOptions struct {
+	Raw  bool
+	Rows uint16
+	Cols uint16
+}
+
+const (
+	defaultRows = 24
+	defaultCols = 80
+)
+
+// terminal is the parent side of a pseudo-terminal.
+type terminal struct {
+	opts    *PTYOptions
+	master  *os.File
+	slave   *os.File
+	stop    chan struct{}
+	restore func() error
+
+	// cancel is closed to stop the copy of stdin, and copied is closed
+	// once the copy has stopped.
+	cancel *os.File
+	copied chan struct{}
+}
+
+func newTerminal(opts *PTYOptions) (*terminal, error) {
+	master, slave, err := openPTY()
+	if err != nil {
+		return nil, err
+	}
+
+	t := &terminal{opts: opts, master: master, slave: slave, stop: make(chan struct{})}
+
+	rows, cols := opts.Rows, opts.Cols
+	if rows == 0 || cols == 0 {
+		rows, cols = defaultRows, defaultCols
+	}
+
+	err = errorx.Join(setWindowSize(master, rows, cols), disableOutputProcessing(slave))
+	if err != nil {
+		return nil, errorx.Join(err, t.close())
+	}
+
+	return t, nil
+}
+
+// started releases the slave side of the terminal and starts to follow the
+// terminal of the current process.
+func (t *terminal) started(stdin io.Reader) error {
+	err := t.slave.Close()
+	t.slave = nil
+	if err != nil {
+		return err
+	}
+
+	if isTerminal(os.Stdin) {
+		followWindowSize(os.Stdin, t.master, t.stop)
+
+		if t.opts.Raw {
+			t.restore, err = makeRaw(os.Stdin)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if stdin != nil {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return err
+		}
+		t.cancel = w
+		t.copied = make(chan struct{})
+
+		master := t.master
+		go func() {
+			defer close(t.copied)
+
+			err := errorx.Join(copyInput(master, stdin, r), r.Close())
+			if err != nil {
+				log.Debugf("pty: %v", err)
+			}
+		}()
+	}
+
+	return nil
+}
+
+// Read reads the output of the child.  EIO is returned on Linux once every
+// process has closed the slave side, so it's treated as EOF.
+func (t *terminal) Read(p []byte) (int, error) {
+	n, err := t.master.Read(p)
+	if err != nil && isEIO(err) {
+		return n, io.EOF
+	}
+	return n, err
+}
+
+func (t *terminal) SetReadDeadline(deadline time.Time) error {
+	return t.master.SetReadDeadline(deadline)
+}
+
+// input returns a writer to the terminal.  Closing it sends EOF to the child
+// rather than closing the terminal.
+func (t *terminal) input() io.WriteCloser {
+	return &terminalInput{t.master}
+}
+
+func (t *terminal) close() error {
+	var errs error
+
+	select {
+	case <-t.stop:
+	default:
+		close(t.stop)
+	}
+
+	// Files are polled by the copy, so it stops even if stdin is idle.
+	// Other readers are waited on until their next read returns, like
+	// os/exec does for stdin.
+	if t.cancel != nil {
+		errs = errorx.Join(errs, t.cancel.Close(), t.master.Close())
+		t.master = nil
+		<-t.copied
+		t.cancel = nil
+	}
+
+	if t.restore != nil {
+		errs = errorx.Join(errs, t.restore())
+		t.restore = nil
+	}
+
+	if t.slave != nil {
+		errs = errorx.Join(errs, t.slave.Close())
+		t.slave = nil
+	}
+
+	if t.master != nil {
+		errs = errorx.Join(errs, t.master.Close())
+		t.master = nil
+	}
+
+	return errs
+}
+
+type terminalInput struct {
+	master *os.File
+}
+
+func (i *terminalInput) Write(p []byte) (int, error) {
+	return i.master.Write(p)
+}
+
+// Close sends the EOF character.  Like in an interactive terminal, it's only
+// interpreted as EOF at the start of a line unless the child changed the mode
+// of the terminal.
+func (i *terminalInput) Close() error {
+	_, err := i.master.Write([]byte{0x04})
+	return err
+}
@@ -0,0 +1,201 @@
+package process
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	ossignal "os/signal"
+	"syscall"
+
+	"github.com/illikainen/go-utils/src/errorx"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+func openPTY() (*os.File, *os.File, error) {
+	// The master is non-blocking so that reads can be interrupted with
+	// a deadline if another process keeps the slave open.
+	fd, err := unix.Open("/dev/ptmx", unix.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "pty")
+	}
+	master := os.NewFile(uintptr(fd), "/dev/ptmx")
+
+	err = unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0)
+	if err != nil {
+		return nil, nil, errorx.Join(errors.Wrap(err, "pty"), master.Close())
+	}
+
+	n, err := unix.IoctlGetUint32(fd, unix.TIOCGPTN)
+	if err != nil {
+		return nil, nil, errorx.Join(errors.Wrap(err, "pty"), master.Close())
+	}
+
+	name := fmt.Sprintf("/dev/pts/%d", n)
+	slave, err := os.OpenFile(name, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, errorx.Join(err, master.Close())
+	}
+
+	return master, slave, nil
+}
+
+// setControllingTerminal starts the child in a new session with the slave
+// as its controlling terminal.
+func setControllingTerminal(cmd *exec.Cmd, slave *os.File) {
+	cmd.Stdin = slave
+	cmd.Stdout = slave
+	cmd.Stderr = slave
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = false
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+	cmd.SysProcAttr.Ctty = 0
+}
+
+// setWindowSize uses the raw descriptor of f because Fd() would put the
+// non-blocking master back in blocking mode.
+func setWindowSize(f *os.File, rows uint16, cols uint16) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return errors.Wrap(err, "pty")
+	}
+
+	var ioctlErr error
+	err = conn.Control(func(fd uintptr) {
+		ioctlErr = unix.IoctlSetWinsize(int(fd), unix.TIOCSWINSZ, &unix.Winsize{Row: rows, Col: cols})
+	})
+	return errors.Wrap(errorx.Join(err, ioctlErr), "pty")
+}
+
+func disableOutputProcessing(f *os.File) error {
+	termios, err := unix.IoctlGetTermios(int(f.Fd()), unix.TCGETS)
+	if err != nil {
+		return errors.Wrap(err, "pty")
+	}
+
+	termios.Oflag &^= unix.OPOST
+	return errors.Wrap(unix.IoctlSetTermios(int(f.Fd()), unix.TCSETS, termios), "pty")
+}
+
+func isTerminal(f *os.File) bool {
+	_, err := unix.IoctlGetTermios(int(f.Fd()), unix.TCGETS)
+	return err == nil
+}
+
+// followWindowSize copies the window size of src to dst now and whenever
+// SIGWINCH is received until stop is closed.
+func followWindowSize(src *os.File, dst *os.File, stop <-chan struct{}) {
+	ch := make(chan os.Signal, 1)
+	ossignal.Notify(ch, unix.SIGWINCH)
+	ch <- unix.SIGWINCH
+
+	go func() {
+		defer ossignal.Stop(ch)
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ch:
+				size, err := unix.IoctlGetWinsize(int(src.Fd()), unix.TIOCGWINSZ)
+				if err == nil {
+					err = setWindowSize(dst, size.Row, size.Col)
+				}
+				if err != nil {
+					log.Debugf("pty: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// makeRaw puts the terminal f in raw mode and returns a function that
+// restores the previous mode.
+func makeRaw(f *os.File) (func() error, error) {
+	fd := int(f.Fd())
+
+	termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return nil, errors.Wrap(err, "pty")
+	}
+	orig := *termios
+
+	// See cfmakeraw(3).
+	termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP |
+		unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	termios.Oflag &^= unix.OPOST
+	termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	termios.Cflag &^= unix.CSIZE | unix.PARENB
+	termios.Cflag |= unix.CS8
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+
+	err = unix.IoctlSetTermios(fd, unix.TCSETS, termios)
+	if err != nil {
+		return nil, errors.Wrap(err, "pty")
+	}
+
+	return func() error {
+		return errors.Wrap(unix.IoctlSetTermios(fd, unix.TCSETS, &orig), "pty")
+	}, nil
+}
+
+func isEIO(err error) bool {
+	return errors.Is(err, unix.EIO)
+}
+
+// copyInput copies src to dst until EOF or until cancel is readable.  Files
+// are polled before they're read, so that the copy can be canceled while src
+// is idle, e.g. if it's an interactive terminal.  Other readers are copied
+// until their next read returns.
+func copyInput(dst io.Writer, src io.Reader, cancel *os.File) error {
+	f, ok := src.(*os.File)
+	if !ok {
+		_, err := io.Copy(dst, src)
+		return err
+	}
+
+	fds := []unix.PollFd{
+		{Fd: int32(f.Fd()), Events: unix.POLLIN},      // #nosec G115
+		{Fd: int32(cancel.Fd()), Events: unix.POLLIN}, // #nosec G115
+	}
+	buf := make([]byte, 32<<10)
+
+	for {
+		_, err := unix.Poll(fds, -1)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			return errors.Wrap(err, "pty")
+		}
+
+		if fds[1].Revents != 0 {
+			return nil
+		}
+		if fds[0].Revents == 0 {
+			continue
+		}
+
+		n, err := f.Read(buf)
+		if n > 0 {
+			_, werr := dst.Write(buf[:n])
+			if werr != nil {
+				return werr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package process_test
+
+import (
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/illikainen/go-utils/src/errorx"
+	"github.com/illikainen/go-utils/src/process"
+	"github.com/illikainen/go-utils/src/test"
+)
+
+func TestPTY(t *testing.T) {
+	out, err := process.Exec(&process.ExecOptions{
+		Command: []string{"sh", "-c", "test -t 0 && test -t 1 && test -t 2 && stty size"},
+		PTY:     &process.PTYOptions{Rows: 30, Cols: 100},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.AssertEq(t, string(out.Stdout), "30 100\n")
+	test.AssertEq(t, len(out.Stderr), 0)
+}
+
+func TestPTYStdin(t *testing.T) {
+	out, err := process.Exec(&process.ExecOptions{
+		Command: []string{"sh", "-c", "read line; echo got $line"},
+		Stdin:   strings.NewReader("foo\n"),
+		PTY:     &process.PTYOptions{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The input is echoed by the terminal.
+	test.AssertEq(t, string(out.Stdout), "foo\ngot foo\n")
+}
+
+func TestPTYIdleStdin(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		test.AssertEq(t, errorx.Join(r.Close(), w.Close()), nil)
+	}()
+
+	before := runtime.NumGoroutine()
+
+	out, err := process.Exec(&process.ExecOptions{
+		Command: []string{"echo", "done"},
+		Stdin:   r,
+		PTY:     &process.PTYOptions{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, string(out.Stdout), "done\n")
+
+	// The copy of stdin is stopped by Wait() rather than leaked until
+	// the next write.
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	test.AssertEq(t, runtime.NumGoroutine() <= before, true)
+}
+
+func TestPTYStart(t *testing.T) {
+	p, err := process.Start(&process.ExecOptions{
+		Command: []string{"cat"},
+		PTY:     &process.PTYOptions{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = io.WriteString(p.Stdin(), "bar\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p.Stdin().Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := p.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, string(out.Stdout), "bar\nbar\n")
+}
@@ -0,0 +1,46 @@
+//go:build !linux
+
+package process
+
+import (
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+func openPTY() (*os.File, *os.File, error) {
+	return nil, nil, errors.Errorf("pty: unsupported platform")
+}
+
+func setControllingTerminal(*exec.Cmd, *os.File) {
+}
+
+func setWindowSize(*os.File, uint16, uint16) error {
+	return errors.Errorf("pty: unsupported platform")
+}
+
+func disableOutputProcessing(*os.File) error {
+	return errors.Errorf("pty: unsupported platform")
+}
+
+func isTerminal(*os.File) bool {
+	return false
+}
+
+func followWindowSize(*os.File, *os.File, <-chan struct{}) {
+}
+
+func makeRaw(*os.File) (func() error, error) {
+	return nil, errors.Errorf("pty: unsupported platform")
+}
+
+func isEIO(error) bool {
+	return false
+}
+
+func copyInput(dst io.Writer, src io.Reader, _ *os.File) error {
+	_, err := io.Copy(dst, src)
+	return err
+}
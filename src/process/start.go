@@ -0,0 +1,414 @@
+package process
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/illikainen/go-utils/src/errorx"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+)
+
+// Process is a started child.  Its output is consumed in the background by
+// the Stdout and Stderr OutputFuncs of the ExecOptions as soon as it's
+// produced, so the funcs can be used to observe the child while it runs.
+type Process struct {
+	ctx      context.Context
+	opts     *ExecOptions
+	args     []string
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	limiter  *limiter
+	pty      *terminal
+	out      *ExecOutput
+	started  time.Time
+	group    errgroup.Group
+	done     chan struct{}
+	canceled chan bool
+	outputs  []deadlineReader
+	readers  []*os.File
+	writers  []*os.File
+	mu       sync.Mutex
+	waited   bool
+}
+
+// deadlineReader is the parent side of the stdout or stderr of a child.
+type deadlineReader interface {
+	io.Reader
+	SetReadDeadline(deadline time.Time) error
+}
+
+// outputReader returns EOF once the read deadline of r has expired.
+type outputReader struct {
+	r deadlineReader
+}
+
+func (o *outputReader) Read(p []byte) (int, error) {
+	n, err := o.r.Read(p)
+	if err != nil && errors.Is(err, os.ErrDeadlineExceeded) {
+		return n, io.EOF
+	}
+	return n, err
+}
+
+func Start(opts *ExecOptions) (*Process, error) {
+	return StartContext(context.Background(), opts)
+}
+
+// StartContext starts a child without waiting for it to exit.  If opts.Stdin
+// is nil, a pipe is connected to the stdin of the child and made available
+// with Stdin().  The child is terminated in the same way as with
+// ExecContext() if ctx is done before it exits.  Wait() must always be called
+// to release the resources of the child.
+func StartContext(ctx context.Context, opts *ExecOptions) (*Process, error) {
+	p, err := newProcess(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Stdin == nil && opts.PTY == nil {
+		p.stdin, err = p.cmd.StdinPipe()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	err = p.start(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Stdin == nil && p.pty != nil {
+		p.stdin = p.pty.input()
+	}
+
+	return p, nil
+}
+
+func newProcess(ctx context.Context, opts *ExecOptions) (*Process, error) {
+	args := opts.Command
+	if opts.Become != "" {
+		esc, err := Become(opts.Become)
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(esc, args...)
+	}
+
+	err := ctx.Err()
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s", args[0])
+	}
+
+	cmd := exec.Command(args[0], args[1:]...) // #nosec G204
+	cmd.Env = Environ(opts.Env, opts.EnvPolicy)
+	cmd.Dir = opts.Dir
+	cmd.Stdin = opts.Stdin
+	cmd.ExtraFiles = opts.ExtraFiles
+
+	// Without a cancellable context, the child remains in our process
+	// group to retain the previous behavior for job control.
+	if ctx.Done() != nil {
+		setProcessGroup(cmd)
+	}
+
+	return &Process{
+		ctx:      ctx,
+		opts:     opts,
+		args:     args,
+		cmd:      cmd,
+		out:      &ExecOutput{ExitCode: 1},
+		done:     make(chan struct{}),
+		canceled: make(chan bool, 1),
+	}, nil
+}
+
+// start starts the child.  If stdout is non-nil, it's used as the stdout of
+// the child instead of a pipe that's consumed by opts.Stdout.
+func (p *Process) start(stdout *os.File) error {
+	limiter, err := prepareLimits(p.opts.Limits, p.cmd)
+	if err != nil {
+		return err
+	}
+	p.limiter = limiter
+
+	var stdoutPipe deadlineReader
+	var stderrPipe deadlineReader
+	switch {
+	case p.opts.PTY != nil:
+		p.pty, err = newTerminal(p.opts.PTY)
+		if err != nil {
+			return errorx.Join(err, p.limiter.close())
+		}
+		setControllingTerminal(p.cmd, p.pty.slave)
+		stdoutPipe = p.pty
+	case stdout != nil:
+		p.cmd.Stdout = stdout
+	default:
+		stdoutPipe, err = p.pipe(&p.cmd.Stdout)
+		if err != nil {
+			return errorx.Join(err, p.limiter.close())
+		}
+	}
+
+	if p.pty == nil {
+		stderrPipe, err = p.pipe(&p.cmd.Stderr)
+		if err != nil {
+			return errorx.Join(err, p.closePipes(), p.limiter.close())
+		}
+	}
+
+	stdoutFunc := p.opts.Stdout
+	if stdoutFunc == nil {
+		stdoutFunc = CaptureOutput
+	}
+
+	stderrFunc := p.opts.Stderr
+	if stderrFunc == nil {
+		stderrFunc = CaptureOutput
+	}
+
+	log.Tracef("exec: %s", strings.Join(p.args, " "))
+	err = p.cmd.Start()
+	if err != nil {
+		// The output goroutines haven't been started yet, so nothing
+		// is leaked.
+		return errorx.Join(errors.WithStack(err), p.closePipes(), p.closeTerminal(), p.limiter.close())
+	}
+	p.started = time.Now()
+
+	// The write ends are only kept open by the child and its descendants
+	// so that EOF is read once they're closed.
+	err = p.closeWriters()
+	if err != nil {
+		return errorx.Join(err, signal(p.cmd, os.Kill), p.cmd.Wait(), p.closePipes(), p.closeTerminal(),
+			p.limiter.close())
+	}
+
+	if p.pty != nil {
+		err := p.pty.started(p.opts.Stdin)
+		if err != nil {
+			return errorx.Join(err, signal(p.cmd, os.Kill), p.cmd.Wait(), p.closeTerminal(),
+				p.limiter.close())
+		}
+		p.outputs = append(p.outputs, p.pty)
+	}
+
+	grace := p.opts.GracePeriod
+	if grace <= 0 {
+		grace = DefaultGracePeriod
+	}
+
+	go func() {
+		select {
+		case <-p.ctx.Done():
+			terminate(p.cmd, grace, p.done)
+			p.canceled <- true
+		case <-p.done:
+			p.canceled <- false
+		}
+	}()
+
+	if stdoutPipe != nil {
+		p.group.Go(func() error {
+			var err error
+			p.out.Stdout, err = stdoutFunc(&outputReader{stdoutPipe}, Stdout, p.opts.Trusted)
+			return p.outputError(err)
+		})
+	}
+
+	if stderrPipe != nil {
+		p.group.Go(func() error {
+			var err error
+			p.out.Stderr, err = stderrFunc(&outputReader{stderrPipe}, Stderr, p.opts.Trusted)
+			return p.outputError(err)
+		})
+	}
+
+	return nil
+}
+
+// pipe connects a new pipe to dst.  Unlike the pipes of exec.Cmd, the read
+// end isn't closed by Cmd.Wait(), so the output can be read after the child
+// has exited.
+func (p *Process) pipe(dst *io.Writer) (*os.File, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	*dst = w
+	p.outputs = append(p.outputs, r)
+	p.readers = append(p.readers, r)
+	p.writers = append(p.writers, w)
+	return r, nil
+}
+
+func (p *Process) closeWriters() error {
+	var errs error
+	for _, w := range p.writers {
+		errs = errorx.Join(errs, w.Close())
+	}
+	p.writers = nil
+	return errs
+}
+
+func (p *Process) closePipes() error {
+	errs := p.closeWriters()
+	for _, r := range p.readers {
+		errs = errorx.Join(errs, r.Close())
+	}
+	p.readers = nil
+	return errs
+}
+
+// waitOutput waits for the OutputFuncs to finish after the child has exited.
+// Descendants of the child may keep its output open, so the reads return EOF
+// once opts.WaitDelay has expired.
+func (p *Process) waitOutput() error {
+	done := make(chan error, 1)
+	go func() {
+		done <- p.group.Wait()
+	}()
+
+	delay := p.opts.WaitDelay
+	if delay <= 0 {
+		delay = DefaultWaitDelay
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+	}
+
+	log.Debugf("exec: %s: output is still open after %s", p.args[0], delay)
+	var errs error
+	for _, r := range p.outputs {
+		errs = errorx.Join(errs, r.SetReadDeadline(time.Now()))
+	}
+	return errorx.Join(<-done, errs)
+}
+
+// outputError kills the child if an OutputFunc fails.  Otherwise, the child
+// may block on a pipe that's no longer read while the other OutputFunc waits
+// for it to exit.
+func (p *Process) outputError(err error) error {
+	if err != nil {
+		killErr := signal(p.cmd, os.Kill)
+		if killErr != nil {
+			log.Debugf("exec: %v", killErr)
+		}
+	}
+	return err
+}
+
+func (p *Process) Pid() int {
+	return p.cmd.Process.Pid
+}
+
+// Stdin returns the write end of the stdin pipe of the child, or nil if
+// ExecOptions.Stdin was set.  It should be closed to signal EOF to the child.
+func (p *Process) Stdin() io.WriteCloser {
+	return p.stdin
+}
+
+// Signal sends a signal to the child, or to its process group if it was
+// started with a cancellable context.
+func (p *Process) Signal(sig os.Signal) error {
+	return signal(p.cmd, sig)
+}
+
+// Wait waits for the child to exit and returns its output.  The returned
+// values and errors are the same as for Exec().
+func (p *Process) Wait() (*ExecOutput, error) {
+	p.mu.Lock()
+	waited := p.waited
+	p.waited = true
+	p.mu.Unlock()
+	if waited {
+		return nil, errors.Errorf("%s: already waited", p.args[0])
+	}
+
+	// The child can't block on a pipe that's no longer read because it's
+	// killed by outputError() if an OutputFunc fails.
+	err := p.cmd.Wait()
+	close(p.done)
+	canceled := <-p.canceled
+
+	outErr := errorx.Join(p.waitOutput(), p.closePipes())
+	termErr := p.closeTerminal()
+	if outErr != nil {
+		return nil, errorx.Join(errors.WithStack(outErr), termErr, p.limiter.close())
+	}
+
+	if canceled {
+		return nil, errorx.Join(errors.Wrapf(p.ctx.Err(), "%s", p.args[0]), termErr, p.limiter.close())
+	}
+
+	limitErr := errorx.Join(termErr, p.limiter.check(p.cmd.ProcessState), p.limiter.close())
+	if limitErr != nil {
+		return nil, limitErr
+	}
+
+	out := p.out
+	out.Duration = time.Since(p.started)
+	out.Usage = newUsage(p.cmd.ProcessState)
+
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			out.ExitCode = exitErr.ExitCode()
+
+			if p.opts.IgnoreExitError {
+				return out, nil
+			}
+
+			return nil, errors.WithStack(newExitError(p.args, p.cmd.ProcessState, out.Duration, out.Stderr))
+		}
+		return nil, errors.WithStack(err)
+	}
+
+	out.ExitCode = 0
+	return out, nil
+}
+
+// failed returns the output that was collected before Wait() failed.  The
+// exit code is -1 unless the child exited normally.
+func (p *Process) failed() *ExecOutput {
+	out := p.out
+	out.ExitCode = -1
+	if p.cmd.ProcessState != nil {
+		out.ExitCode = p.cmd.ProcessState.ExitCode()
+		out.Usage = newUsage(p.cmd.ProcessState)
+	}
+	return out
+}
+
+func (p *Process) closeTerminal() error {
+	if p.pty == nil {
+		return nil
+	}
+	return p.pty.close()
+}
+
+// abort kills a started child and releases its resources.
+func (p *Process) abort() error {
+	err := signal(p.cmd, os.Kill)
+	_, waitErr := p.Wait()
+	if waitErr != nil {
+		log.Debugf("exec: %v", waitErr)
+	}
+	return err
+}
@@ -0,0 +1,97 @@
+package process_test
+
+import (
+	"io"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/illikainen/go-utils/src/process"
+	"github.com/illikainen/go-utils/src/test"
+)
+
+func TestStart(t *testing.T) {
+	p, err := process.Start(&process.ExecOptions{
+		Command: []string{"cat"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertNe(t, p.Pid(), 0)
+
+	_, err = io.WriteString(p.Stdin(), "foo\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p.Stdin().Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := p.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, string(out.Stdout), "foo\n")
+
+	_, err = p.Wait()
+	test.AssertNe(t, err, nil)
+}
+
+func TestStartSignal(t *testing.T) {
+	p, err := process.Start(&process.ExecOptions{
+		Command:         []string{"sleep", "10"},
+		IgnoreExitError: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p.Signal(syscall.SIGTERM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := p.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, out.ExitCode, -1)
+}
+
+func TestStartWaitDelay(t *testing.T) {
+	started := time.Now()
+	out, err := process.Exec(&process.ExecOptions{
+		Command:   []string{"sh", "-c", "echo foo; setsid sleep 10 &"},
+		WaitDelay: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, string(out.Stdout), "foo\n")
+
+	if time.Since(started) >= 5*time.Second {
+		t.Fatalf("waited for the grandchild")
+	}
+}
+
+func TestStartConcurrentWait(t *testing.T) {
+	p, err := process.Start(&process.ExecOptions{
+		Command: []string{"true"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := p.Wait()
+			errs <- err
+		}()
+	}
+
+	first, second := <-errs, <-errs
+	test.AssertEq(t, (first == nil) != (second == nil), true)
+}
@@ -0,0 +1,27 @@
+//go:build !unix
+
+package rpc
+
+import (
+	"net"
+	"os"
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+func Socketpair() (*os.File, *net.UnixConn, error) {
+	return nil, nil, errors.Errorf("rpc: %s is not supported", runtime.GOOS)
+}
+
+func oobSize(int) int {
+	return 0
+}
+
+func unixRights([]*os.File) ([]byte, error) {
+	return nil, errors.Errorf("rpc: file passing is not supported on %s", runtime.GOOS)
+}
+
+func parseRights([]byte) ([]*os.File, error) {
+	return nil, nil
+}
@@ -0,0 +1,82 @@
+//go:build unix
+
+package rpc
+
+import (
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/illikainen/go-utils/src/errorx"
+
+	"github.com/pkg/errors"
+)
+
+// Socketpair returns a connected pair of unix sockets.  The file is meant to
+// be inherited by a child process that opens it with FileConn().
+func Socketpair() (*os.File, *net.UnixConn, error) {
+	syscall.ForkLock.RLock()
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err == nil {
+		syscall.CloseOnExec(fds[0])
+		syscall.CloseOnExec(fds[1])
+	}
+	syscall.ForkLock.RUnlock()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "socketpair")
+	}
+
+	child := os.NewFile(uintptr(fds[0]), "rpc-child")
+	parent := os.NewFile(uintptr(fds[1]), "rpc-parent")
+
+	conn, err := net.FileConn(parent)
+	err = errorx.Join(err, parent.Close())
+	if err != nil {
+		return nil, nil, errorx.Join(err, child.Close())
+	}
+
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, nil, errorx.Join(errors.Errorf("rpc: invalid socket"), conn.Close(), child.Close())
+	}
+
+	return child, uc, nil
+}
+
+func oobSize(files int) int {
+	return syscall.CmsgSpace(files * 4)
+}
+
+func unixRights(files []*os.File) ([]byte, error) {
+	fds := []int{}
+	for _, f := range files {
+		fds = append(fds, int(f.Fd()))
+	}
+	return syscall.UnixRights(fds...), nil
+}
+
+func parseRights(oob []byte) ([]*os.File, error) {
+	if len(oob) == 0 {
+		return nil, nil
+	}
+
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []*os.File{}
+	for _, msg := range msgs {
+		fds, err := syscall.ParseUnixRights(&msg)
+		if err != nil {
+			return nil, errorx.Join(err, closeFiles(files))
+		}
+
+		for _, fd := range fds {
+			syscall.CloseOnExec(fd)
+			files = append(files, os.NewFile(uintptr(fd), "rpc"))
+		}
+	}
+
+	return files, nil
+}
@@ -0,0 +1,408 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/illikainen/go-utils/src/errorx"
+	"github.com/illikainen/go-utils/src/stringx"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// MaxMessageSize is the largest message that's accepted by a Conn.
+const MaxMessageSize = 16 << 20
+
+// MaxFiles is the largest number of files that can be attached to a message.
+const MaxFiles = 16
+
+// MaxConcurrentRequests is the largest number of requests that are handled
+// concurrently by a Conn.  Additional requests fail until a handler returns.
+const MaxConcurrentRequests = 64
+
+var ErrClosed = errors.New("rpc: connection closed")
+
+// Handler processes a request.  The files in the request are owned by the
+// handler.  The returned files are sent to the caller and closed afterwards.
+type Handler func(params json.RawMessage, files []*os.File) (any, []*os.File, error)
+
+// RemoteError is returned by Call() if the handler on the other side of the
+// connection failed.  The message is provided by the peer, so it's sanitized
+// by Error().
+type RemoteError struct {
+	Method  string
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("rpc: %s: %s", stringx.Sanitize(e.Method), stringx.Sanitize(e.Message))
+}
+
+// Mux maps method names to handlers.
+type Mux struct {
+	mu       sync.RWMutex
+	handlers map[string]Handler
+}
+
+func NewMux() *Mux {
+	return &Mux{handlers: map[string]Handler{}}
+}
+
+func (m *Mux) Handle(method string, handler Handler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handlers[method] = handler
+}
+
+// Clone returns a copy of the mux that can be extended without affecting
+// the original.
+func (m *Mux) Clone() *Mux {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	clone := NewMux()
+	for method, handler := range m.handlers {
+		clone.handlers[method] = handler
+	}
+	return clone
+}
+
+func (m *Mux) handler(method string) (Handler, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	handler, ok := m.handlers[method]
+	return handler, ok
+}
+
+// Func adapts a typed function to a Handler.
+func Func[P any, R any](fn func(P) (R, error)) Handler {
+	return func(params json.RawMessage, files []*os.File) (any, []*os.File, error) {
+		err := closeFiles(files)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var p P
+		if len(params) > 0 {
+			err := json.Unmarshal(params, &p)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
+		r, err := fn(p)
+		return r, nil, err
+	}
+}
+
+type message struct {
+	ID     uint64          `json:"id"`
+	Reply  bool            `json:"reply,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	Files  int             `json:"files,omitempty"`
+
+	files []*os.File
+}
+
+// Conn is a bidirectional request/response channel over a unix socket.
+// Messages are JSON encoded and prefixed with their length as a big-endian
+// uint32.  Files are passed with SCM_RIGHTS.  Both sides of a connection can
+// issue calls and serve requests concurrently.
+type Conn struct {
+	conn    *net.UnixConn
+	mux     *Mux
+	wmu     sync.Mutex
+	mu      sync.Mutex
+	pending map[uint64]chan *message
+	nextID  uint64
+	err     error
+}
+
+// NewConn creates a connection that dispatches incoming requests to mux.  If
+// mux is nil, every request fails.  Serve() must be running for calls to
+// complete.
+func NewConn(conn *net.UnixConn, mux *Mux) *Conn {
+	if mux == nil {
+		mux = NewMux()
+	}
+
+	return &Conn{
+		conn:    conn,
+		mux:     mux,
+		pending: map[uint64]chan *message{},
+	}
+}
+
+// FileConn creates a connection from an inherited socket.  The file is closed.
+func FileConn(f *os.File, mux *Mux) (*Conn, error) {
+	conn, err := net.FileConn(f)
+	err = errorx.Join(err, f.Close())
+	if err != nil {
+		return nil, err
+	}
+
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, errorx.Join(errors.Errorf("rpc: %s is not a unix socket", f.Name()), conn.Close())
+	}
+
+	return NewConn(uc, mux), nil
+}
+
+// Serve reads messages until the connection is closed.  Up to
+// MaxConcurrentRequests requests are handled concurrently.  Serve doesn't
+// wait for a handler to return before it rejects a request, because
+// handlers may depend on replies that are read by Serve.  It returns nil if
+// the peer closed the connection.
+func (c *Conn) Serve() error {
+	sem := make(chan struct{}, MaxConcurrentRequests)
+
+	var err error
+	for {
+		var msg *message
+		msg, err = c.read()
+		if err != nil {
+			break
+		}
+
+		if msg.Reply {
+			c.mu.Lock()
+			ch, ok := c.pending[msg.ID]
+			delete(c.pending, msg.ID)
+			c.mu.Unlock()
+
+			if !ok {
+				log.Debugf("rpc: unexpected reply: %d", msg.ID)
+				err = closeFiles(msg.files)
+				if err != nil {
+					break
+				}
+				continue
+			}
+			ch <- msg
+			continue
+		}
+
+		select {
+		case sem <- struct{}{}:
+			go func() {
+				defer func() { <-sem }()
+				c.handle(msg)
+			}()
+		default:
+			c.reject(msg, "too many concurrent requests")
+		}
+	}
+
+	if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+		err = nil
+	}
+
+	c.mu.Lock()
+	c.err = ErrClosed
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+
+	return err
+}
+
+// Call invokes a method on the other side of the connection.  The result is
+// decoded into result unless it's nil.  The files are sent to the peer but
+// not closed.  Files in the response are returned to the caller.
+func (c *Conn) Call(method string, params any, result any, files ...*os.File) ([]*os.File, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *message, 1)
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	err = c.write(&message{ID: id, Method: method, Params: data, files: files})
+	if err != nil {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return nil, err
+	}
+
+	reply, ok := <-ch
+	if !ok {
+		return nil, ErrClosed
+	}
+
+	if reply.Error != "" {
+		return nil, errorx.Join(&RemoteError{Method: method, Message: reply.Error}, closeFiles(reply.files))
+	}
+
+	if result != nil && len(reply.Result) > 0 {
+		err := json.Unmarshal(reply.Result, result)
+		if err != nil {
+			return nil, errorx.Join(err, closeFiles(reply.files))
+		}
+	}
+
+	return reply.files, nil
+}
+
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Conn) handle(msg *message) {
+	reply := &message{ID: msg.ID, Reply: true}
+
+	handler, ok := c.mux.handler(msg.Method)
+	if !ok {
+		c.reject(msg, fmt.Sprintf("unknown method: %s", msg.Method))
+		return
+	}
+
+	result, files, err := handler(msg.Params, msg.files)
+	if err == nil {
+		reply.Result, err = json.Marshal(result)
+	}
+
+	if err != nil {
+		reply.Error = err.Error()
+	} else {
+		reply.files = files
+	}
+	defer func() {
+		err := closeFiles(files)
+		if err != nil {
+			log.Debugf("rpc: %v", err)
+		}
+	}()
+
+	err = c.write(reply)
+	if err != nil {
+		log.Debugf("rpc: %s: %v", msg.Method, err)
+	}
+}
+
+// reject replies to a request with an error without invoking a handler.
+func (c *Conn) reject(msg *message, reason string) {
+	err := errorx.Join(closeFiles(msg.files), c.write(&message{ID: msg.ID, Reply: true, Error: reason}))
+	if err != nil {
+		log.Debugf("rpc: %s: %v", msg.Method, err)
+	}
+}
+
+func (c *Conn) write(msg *message) error {
+	if len(msg.files) > MaxFiles {
+		return errors.Errorf("rpc: too many files: %d", len(msg.files))
+	}
+	msg.Files = len(msg.files)
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	if len(payload) > MaxMessageSize {
+		return errors.Errorf("rpc: message too large: %d", len(payload))
+	}
+
+	frame := make([]byte, 4+len(payload))
+	binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+	copy(frame[4:], payload)
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	n := 0
+	if len(msg.files) > 0 {
+		oob, err := unixRights(msg.files)
+		if err != nil {
+			return err
+		}
+
+		n, _, err = c.conn.WriteMsgUnix(frame, oob, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = c.conn.Write(frame[n:])
+	return err
+}
+
+func (c *Conn) read() (*message, error) {
+	hdr := make([]byte, 4)
+	oob := make([]byte, oobSize(MaxFiles))
+
+	// The files are attached to the first byte of a frame, so they're
+	// received together with the header.
+	n, oobn, _, _, err := c.conn.ReadMsgUnix(hdr, oob)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, io.EOF
+	}
+
+	files, err := parseRights(oob[:oobn])
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = io.ReadFull(c.conn, hdr[n:])
+	if err != nil {
+		return nil, errorx.Join(err, closeFiles(files))
+	}
+
+	size := binary.BigEndian.Uint32(hdr)
+	if size > MaxMessageSize {
+		return nil, errorx.Join(errors.Errorf("rpc: message too large: %d", size), closeFiles(files))
+	}
+
+	payload := make([]byte, size)
+	_, err = io.ReadFull(c.conn, payload)
+	if err != nil {
+		return nil, errorx.Join(err, closeFiles(files))
+	}
+
+	msg := &message{}
+	err = json.Unmarshal(payload, msg)
+	if err != nil {
+		return nil, errorx.Join(err, closeFiles(files))
+	}
+
+	if msg.Files != len(files) {
+		return nil, errorx.Join(errors.Errorf("rpc: expected %d file(s), got %d", msg.Files, len(files)),
+			closeFiles(files))
+	}
+	msg.files = files
+
+	return msg, nil
+}
+
+func closeFiles(files []*os.File) error {
+	var errs error
+	for _, f := range files {
+		errs = errorx.Join(errs, f.Close())
+	}
+	return errs
+}
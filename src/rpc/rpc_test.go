@@ -0,0 +1,170 @@
+package rpc_test
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/illikainen/go-utils/src/rpc"
+	"github.com/illikainen/go-utils/src/test"
+
+	"github.com/pkg/errors"
+)
+
+type params struct {
+	Name string `json:"name"`
+}
+
+func pair(t *testing.T, parentMux *rpc.Mux, childMux *rpc.Mux) (*rpc.Conn, *rpc.Conn) {
+	t.Helper()
+
+	f, uc, err := rpc.Socketpair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parent := rpc.NewConn(uc, parentMux)
+	child, err := rpc.FileConn(f, childMux)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() { _ = parent.Serve() }()
+	go func() { _ = child.Serve() }()
+
+	t.Cleanup(func() {
+		_ = parent.Close()
+		_ = child.Close()
+	})
+
+	return parent, child
+}
+
+func TestCall(t *testing.T) {
+	parentMux := rpc.NewMux()
+	parentMux.Handle("upper", rpc.Func(func(p params) (string, error) {
+		return strings.ToUpper(p.Name), nil
+	}))
+	parentMux.Handle("fail", rpc.Func(func(p params) (string, error) {
+		return "", errors.Errorf("failed: %s", p.Name)
+	}))
+
+	childMux := rpc.NewMux()
+	childMux.Handle("lower", rpc.Func(func(p params) (string, error) {
+		return strings.ToLower(p.Name), nil
+	}))
+
+	parent, child := pair(t, parentMux, childMux)
+
+	result := ""
+	_, err := child.Call("upper", &params{Name: "foo"}, &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, result, "FOO")
+
+	_, err = parent.Call("lower", &params{Name: "BAR"}, &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, result, "bar")
+
+	_, err = child.Call("fail", &params{Name: "baz"}, &result)
+	var remoteErr *rpc.RemoteError
+	if !errors.As(err, &remoteErr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	test.AssertEq(t, remoteErr.Message, "failed: baz")
+
+	_, err = child.Call("missing", nil, nil)
+	test.AssertNe(t, err, nil)
+}
+
+func TestCallFiles(t *testing.T) {
+	path := t.TempDir() + "/file"
+	err := os.WriteFile(path, []byte("secret"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := rpc.NewMux()
+	mux.Handle("open", func(data json.RawMessage, _ []*os.File) (any, []*os.File, error) {
+		p := params{}
+		err := json.Unmarshal(data, &p)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		f, err := os.Open(p.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, []*os.File{f}, nil
+	})
+
+	_, child := pair(t, mux, nil)
+
+	files, err := child.Call("open", &params{Name: path}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, len(files), 1)
+
+	data, err := io.ReadAll(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, string(data), "secret")
+	test.AssertEq(t, files[0].Close(), nil)
+}
+
+func TestClosed(t *testing.T) {
+	parent, child := pair(t, nil, nil)
+	test.AssertEq(t, parent.Close(), nil)
+
+	_, err := child.Call("foo", nil, nil)
+	test.AssertNe(t, err, nil)
+}
+
+func TestRemoteErrorSanitize(t *testing.T) {
+	err := &rpc.RemoteError{Method: "foo\x1b]0;bar\x07", Message: "baz\x1b[2J"}
+	test.AssertEq(t, strings.ContainsAny(err.Error(), "\x1b\x07"), false)
+}
+
+func TestConcurrentRequests(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, rpc.MaxConcurrentRequests)
+
+	mux := rpc.NewMux()
+	mux.Handle("block", rpc.Func(func(p params) (string, error) {
+		started <- struct{}{}
+		<-release
+		return p.Name, nil
+	}))
+
+	_, child := pair(t, mux, nil)
+	errs := make(chan error, rpc.MaxConcurrentRequests)
+	for i := 0; i < rpc.MaxConcurrentRequests; i++ {
+		go func() {
+			_, err := child.Call("block", &params{}, nil)
+			errs <- err
+		}()
+	}
+	for i := 0; i < rpc.MaxConcurrentRequests; i++ {
+		<-started
+	}
+
+	_, err := child.Call("block", &params{}, nil)
+	var remoteErr *rpc.RemoteError
+	if !errors.As(err, &remoteErr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	test.AssertEq(t, remoteErr.Message, "too many concurrent requests")
+
+	close(release)
+	for i := 0; i < rpc.MaxConcurrentRequests; i++ {
+		test.AssertEq(t, <-errs, nil)
+	}
+}
@@ -3,28 +3,49 @@ package sandbox
 import (
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/illikainen/go-utils/src/errorx"
 	"github.com/illikainen/go-utils/src/iofs"
 	"github.com/illikainen/go-utils/src/process"
+	"github.com/illikainen/go-utils/src/rpc"
 	"github.com/illikainen/go-utils/src/seq"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
+// BubblewrapOptions configures a bwrap sandbox.  UID and GID are the IDs of
+// the child in the user namespace, and the IDs of the caller are used if
+// they're nil.  Hostname sets the hostname in the UTS namespace.
+//
+// Supplementary groups can't be dropped in an unprivileged user namespace
+// because bwrap denies setgroups().  They're shown as the overflow GID in
+// the sandbox but still grant access to mounted paths, so they're listed in
+// Plan.Groups.
 type BubblewrapOptions struct {
 	Command          []string
 	Env              []string
+	UID              *int
+	GID              *int
+	Hostname         string
+	EnvPolicy        *process.EnvPolicy
 	ReadOnlyPaths    []string
 	ReadWritePaths   []string
 	DevPaths         []string
+	OverlayPaths     []string
 	AllowCommonPaths bool
 	Tmpfs            bool
 	Devtmpfs         bool
 	Procfs           bool
 	ShareNet         bool
+	Network          *NetworkProxy
+	Seccomp          *SeccompPolicy
+	Limits           *process.ResourceLimits
+	RPC              *rpc.Mux
 	Stdin            io.Reader
 	Stdout           process.OutputFunc
 	Stderr           process.OutputFunc
@@ -35,10 +56,62 @@ type Bubblewrap struct {
 	readOnlyPaths  []string
 	readWritePaths []string
 	devPaths       []string
+	overlays       []*Overlay
+	files          []*namedFile
+	entrypoint     string
+	skipped        []Mount
+	reasons        map[string]string
 }
 
-func NewBubblewrap(opts *BubblewrapOptions) (*Bubblewrap, error) {
-	b := &Bubblewrap{BubblewrapOptions: opts}
+const (
+	// overflowID is the ID that unmapped users and groups are shown as in
+	// a user namespace.
+	overflowID = 65534
+
+	maxHostname = 64
+)
+
+var commonPaths = []string{
+	"/etc/passwd",
+	"/etc/hosts",
+	"/etc/resolv.conf",
+	"/etc/nsswitch.conf",
+	"/etc/os-release",
+	"/bin",
+	"/usr",
+	"/lib",
+	"/lib32",
+	"/lib64",
+}
+
+func NewBubblewrap(options *BubblewrapOptions) (*Bubblewrap, error) {
+	// The options are copied so that they can be reused for other
+	// sandboxes.
+	opts := *options
+	b := &Bubblewrap{BubblewrapOptions: &opts, reasons: map[string]string{}}
+
+	for _, id := range []*int{opts.UID, opts.GID} {
+		if id != nil && (*id < 0 || *id >= overflowID) {
+			return nil, errors.Errorf("bubblewrap: invalid id: %d", *id)
+		}
+	}
+
+	if strings.ContainsAny(opts.Hostname, "/\x00") || len(opts.Hostname) > maxHostname {
+		return nil, errors.Errorf("bubblewrap: invalid hostname: %s", opts.Hostname)
+	}
+
+	if opts.Network != nil {
+		if opts.ShareNet {
+			return nil, errors.Errorf("bubblewrap: a network proxy requires an unshared network")
+		}
+
+		if opts.RPC == nil {
+			opts.RPC = rpc.NewMux()
+		} else {
+			opts.RPC = opts.RPC.Clone()
+		}
+		opts.Network.Register(opts.RPC)
+	}
 
 	err := b.AddReadWritePath(opts.ReadWritePaths...)
 	if err != nil {
@@ -55,6 +128,14 @@ func NewBubblewrap(opts *BubblewrapOptions) (*Bubblewrap, error) {
 		return nil, err
 	}
 
+	for _, path := range opts.OverlayPaths {
+		o, err := NewOverlay(path, "")
+		if err != nil {
+			return nil, err
+		}
+		b.AddOverlay(o)
+	}
+
 	return b, nil
 }
 
@@ -72,6 +153,8 @@ func (b *Bubblewrap) AddReadOnlyPath(path ...string) error {
 			}
 			if exists {
 				b.readOnlyPaths = append(b.readOnlyPaths, p)
+			} else {
+				b.skipped = append(b.skipped, skippedMount(MountReadOnly, p, "does not exist"))
 			}
 		}
 	}
@@ -91,6 +174,7 @@ func (b *Bubblewrap) AddReadWritePath(path ...string) error {
 				return err
 			}
 
+			requested := p
 			for !exists {
 				p = filepath.Dir(p)
 				exists, err = iofs.Exists(p)
@@ -99,6 +183,9 @@ func (b *Bubblewrap) AddReadWritePath(path ...string) error {
 				}
 			}
 
+			if p != requested {
+				b.reasons[p] = fmt.Sprintf("nearest existing parent of %s", requested)
+			}
 			b.readWritePaths = append(b.readWritePaths, p)
 		}
 	}
@@ -119,11 +206,20 @@ func (b *Bubblewrap) AddDevPath(path ...string) error {
 			}
 			if exists {
 				b.devPaths = append(b.devPaths, p)
+			} else {
+				b.skipped = append(b.skipped, skippedMount(MountDev, p, "does not exist"))
 			}
 		}
 	}
 	return nil
 }
+
+// AddOverlay makes the directories writable in the sandbox without
+// modifying them on the host.
+func (b *Bubblewrap) AddOverlay(overlay ...*Overlay) {
+	b.overlays = append(b.overlays, overlay...)
+}
+
 func (b *Bubblewrap) SetShareNet(value bool) {
 	b.ShareNet = value
 }
@@ -140,19 +236,16 @@ func (b *Bubblewrap) SetStderr(w process.OutputFunc) {
 	b.Stderr = w
 }
 
-func (b *Bubblewrap) Confine() error {
-	if IsSandboxed() {
-		return nil
-	}
-
+// Plan computes the bwrap invocation without starting it.
+func (b *Bubblewrap) Plan() (*Plan, error) {
 	bin, err := os.Executable()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	bin, err = filepath.Abs(bin)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// The current work directory needs to exist in the sandbox to support
@@ -161,9 +254,10 @@ func (b *Bubblewrap) Confine() error {
 	// created in the sandbox.
 	cwd, err := os.Getwd()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	plan := &Plan{}
 	args := []string{
 		"bwrap",
 		"--new-session",
@@ -176,94 +270,275 @@ func (b *Bubblewrap) Confine() error {
 		"--cap-drop", "ALL",
 		"--tmpfs", cwd,
 	}
+	plan.addMount(MountTmpfs, "", cwd, "working directory")
 
 	if b.Devtmpfs {
 		args = append(args, "--dev", "/dev")
-		log.Debug("bubblewrap: devtmpfs enabled")
+		plan.addMount(MountDevtmpfs, "", "/dev", "devtmpfs enabled")
 	}
 
 	if b.Procfs {
 		args = append(args, "--proc", "/proc")
-		log.Debugf("bubblewrap: procfs enabled")
+		plan.addMount(MountProcfs, "", "/proc", "procfs enabled")
 	}
 
 	if b.Tmpfs {
 		args = append(args, "--tmpfs", "/tmp")
-		log.Debug("bubblewrap: tmpfs enabled")
+		plan.addMount(MountTmpfs, "", "/tmp", "tmpfs enabled")
 	}
 
 	if !b.ShareNet {
 		args = append(args, "--unshare-net")
+	}
+	plan.ShareNet = b.ShareNet
+
+	if b.Network != nil {
+		plan.Proxy = append([]string{}, b.Network.Allow...)
+	}
+
+	identity, err := b.identityArgs(plan)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, identity...)
+
+	if b.AllowCommonPaths {
+		for _, path := range commonPaths {
+			args = append(args, "--ro-bind-try", path, path)
+			plan.addMount(MountReadOnlyTry, path, path, "common path")
+		}
+
+		args = append(args, "--ro-bind", bin, bin)
+		plan.addMount(MountReadOnly, bin, bin, "executable")
+	}
+
+	args = append(args, b.pathArgs(plan)...)
+
+	// The order of the inherited files must match Confine().
+	fd := 3
+	extraEnv := []string{fmt.Sprintf("%s=1", activeEnv)}
+
+	if b.RPC != nil {
+		extraEnv = append(extraEnv, fmt.Sprintf("%s=%d", rpcEnv, fd))
+		fd++
+	}
+
+	if len(b.files) > 0 {
+		names := []string{}
+		for _, nf := range b.files {
+			names = append(names, fmt.Sprintf("%s=%d", nf.name, fd))
+			plan.Files = append(plan.Files, nf.name)
+			fd++
+		}
+		extraEnv = append(extraEnv, fmt.Sprintf("%s=%s", filesEnv, strings.Join(names, ",")))
+	}
+
+	if b.Seccomp != nil {
+		args = append(args, "--seccomp", fmt.Sprintf("%d", fd))
+		plan.Seccomp = b.Seccomp.Syscalls()
+	}
+
+	if b.entrypoint != "" {
+		args = append(args, bin)
+		extraEnv = append(extraEnv, fmt.Sprintf("%s=%s", entrypointEnv, b.entrypoint))
+	} else if len(b.Command) == 0 {
+		args = append(args, bin)
+		args = append(args, os.Args[1:]...)
 	} else {
+		args = append(args, b.Command...)
+	}
+
+	plan.Args = args
+	plan.Env = append(process.Environ(b.Env, b.EnvPolicy), extraEnv...)
+	return plan, nil
+}
+
+func (b *Bubblewrap) Confine() error {
+	if IsSandboxed() {
+		return nil
+	}
+
+	err := b.run()
+	if err != nil {
+		return err
+	}
+
+	os.Exit(0) // revive:disable-line
+	return nil
+}
+
+// run starts the sandbox and waits for it to exit.
+func (b *Bubblewrap) run() (err error) {
+	plan, err := b.Plan()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range plan.Mounts {
+		if m.Skipped {
+			log.Debugf("bubblewrap: skipped %s: %s (%s)", m.Type, m.Target, m.Reason)
+		} else {
+			log.Debugf("bubblewrap: %s: %s", m.Type, m.Target)
+		}
+	}
+
+	if plan.ShareNet {
 		log.Debug("bubblewrap: net enabled")
+	} else if b.Network != nil {
+		log.Debugf("bubblewrap: net proxied: %s", strings.Join(plan.Proxy, ","))
 	}
 
-	if b.AllowCommonPaths {
-		args = append(
-			args,
-			"--ro-bind-try", "/etc/passwd", "/etc/passwd",
-			"--ro-bind-try", "/etc/hosts", "/etc/hosts",
-			"--ro-bind-try", "/etc/resolv.conf", "/etc/resolv.conf",
-			"--ro-bind-try", "/etc/nsswitch.conf", "/etc/nsswitch.conf",
-			"--ro-bind-try", "/etc/os-release", "/etc/os-release",
-			"--ro-bind-try", "/bin", "/bin",
-			"--ro-bind-try", "/usr", "/usr",
-			"--ro-bind-try", "/lib", "/lib",
-			"--ro-bind-try", "/lib32", "/lib32",
-			"--ro-bind-try", "/lib64", "/lib64",
-			"--ro-bind", bin, bin,
-		)
+	files := []*os.File{}
+
+	if b.RPC != nil {
+		var child *os.File
+		var conn *net.UnixConn
+		child, conn, err = rpc.Socketpair()
+		if err != nil {
+			return err
+		}
+		defer errorx.Defer(child.Close, &err)
+		files = append(files, child)
+
+		c := rpc.NewConn(conn, b.RPC)
+		defer errorx.Defer(c.Close, &err)
+		go func() {
+			err := c.Serve()
+			if err != nil {
+				log.Debugf("bubblewrap: rpc: %v", err)
+			}
+		}()
+		log.Debug("bubblewrap: rpc enabled")
+	}
+
+	if len(b.files) > 0 {
+		defer errorx.Defer(b.closeFiles, &err)
+
+		for _, nf := range b.files {
+			files = append(files, nf.file)
+			log.Debugf("bubblewrap: file: %s", nf.name)
+		}
 	}
 
+	if b.Seccomp != nil {
+		var f *os.File
+		f, err = b.Seccomp.File()
+		if err != nil {
+			return err
+		}
+		defer errorx.Defer(f.Close, &err)
+		files = append(files, f)
+		log.Debugf("bubblewrap: seccomp: %s", strings.Join(plan.Seccomp, ","))
+	}
+
+	log.Trace("bubblewrap: starting subprocess...")
+	_, err = process.Exec(&process.ExecOptions{
+		Command:    plan.Args,
+		Env:        plan.Env,
+		Stdin:      b.Stdin,
+		Stdout:     b.Stdout,
+		Stderr:     b.Stderr,
+		ExtraFiles: files,
+		Limits:     b.Limits,
+	})
+	return err
+}
+
+// identityArgs returns the arguments for the IDs and hostname in the
+// sandbox.
+func (b *Bubblewrap) identityArgs(plan *Plan) ([]string, error) {
+	args := []string{}
+
+	if b.UID != nil {
+		args = append(args, "--uid", fmt.Sprintf("%d", *b.UID))
+		plan.UID = *b.UID
+	} else {
+		plan.UID = os.Getuid()
+	}
+
+	if b.GID != nil {
+		args = append(args, "--gid", fmt.Sprintf("%d", *b.GID))
+		plan.GID = *b.GID
+	} else {
+		plan.GID = os.Getgid()
+	}
+
+	groups, err := os.Getgroups()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for _, group := range groups {
+		if group != os.Getgid() {
+			plan.Groups = append(plan.Groups, group)
+		}
+	}
+
+	if b.Hostname != "" {
+		args = append(args, "--hostname", b.Hostname)
+		plan.Hostname = b.Hostname
+	}
+
+	return args, nil
+}
+
+// pathArgs returns the arguments for the requested mounts.  Paths are only
+// mounted once, and the first mount of a path takes precedence.
+func (b *Bubblewrap) pathArgs(plan *Plan) []string {
+	args := []string{}
+
 	paths := []string{}
 	for _, path := range b.readWritePaths {
 		if !seq.Contains(paths, path) {
 			args = append(args, "--bind", path, path)
-			log.Debugf("bubblewrap: rw: %s", path)
+			plan.addMount(MountReadWrite, path, path, b.reason(path))
 			paths = append(paths, path)
+		} else {
+			plan.skipMount(MountReadWrite, path, "already mounted")
 		}
 	}
 
 	for _, path := range b.readOnlyPaths {
 		if !seq.Contains(paths, path) {
 			args = append(args, "--ro-bind", path, path)
-			log.Debugf("bubblewrap: ro: %s", path)
+			plan.addMount(MountReadOnly, path, path, b.reason(path))
 			paths = append(paths, path)
+		} else {
+			plan.skipMount(MountReadOnly, path, "already mounted")
 		}
 	}
 
 	for _, path := range b.devPaths {
 		if !seq.Contains(paths, path) {
 			args = append(args, "--dev-bind", path, path)
-			log.Debugf("bubblewrap: dev: %s", path)
+			plan.addMount(MountDev, path, path, b.reason(path))
 			paths = append(paths, path)
+		} else {
+			plan.skipMount(MountDev, path, "already mounted")
 		}
 	}
 
-	if len(b.Command) == 0 {
-		args = append(args, bin)
-		args = append(args, os.Args[1:]...)
-	} else {
-		args = append(args, b.Command...)
+	for _, o := range b.overlays {
+		if !seq.Contains(paths, o.Path) {
+			args = append(args, o.args()...)
+			if o.Dir == "" {
+				plan.addMount(MountTmpOverlay, "", o.Path, "discarded on exit")
+			} else {
+				plan.addMount(MountOverlay, o.upper(), o.Path, "requested")
+			}
+			paths = append(paths, o.Path)
+		} else {
+			plan.skipMount(MountOverlay, o.Path, "already mounted")
+		}
 	}
 
-	env := b.Env
-	if env == nil {
-		env = os.Environ()
-	}
+	plan.Mounts = append(plan.Mounts, b.skipped...)
+	return args
+}
 
-	log.Trace("bubblewrap: starting subprocess...")
-	_, err = process.Exec(&process.ExecOptions{
-		Command: args,
-		Env:     append(env, fmt.Sprintf("%s=1", activeEnv)),
-		Stdin:   b.Stdin,
-		Stdout:  b.Stdout,
-		Stderr:  b.Stderr,
-	})
-	if err != nil {
-		return err
+func (b *Bubblewrap) reason(path string) string {
+	reason, ok := b.reasons[path]
+	if !ok {
+		return "requested"
 	}
-
-	os.Exit(0) // revive:disable-line
-	return nil
+	return reason
 }
@@ -0,0 +1,226 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/illikainen/go-utils/src/errorx"
+	"github.com/illikainen/go-utils/src/rpc"
+	"github.com/illikainen/go-utils/src/stringx"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const entrypointEnv = "GO_SANDBOX_ENTRYPOINT"
+
+const (
+	argsMethod   = "sandbox.args"
+	resultMethod = "sandbox.result"
+)
+
+// Entrypoint is a function that can be run in a sandbox with Run().  The
+// arguments and the result are serialized as JSON across the sandbox
+// boundary.
+type Entrypoint func(args json.RawMessage) (any, error)
+
+type entrypointResult struct {
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+var entrypoints = struct {
+	sync.RWMutex
+	fns map[string]Entrypoint
+}{fns: map[string]Entrypoint{}}
+
+// Register makes fn available to Run() under name.  Entrypoints must be
+// registered in both the parent and the sandbox, so they should be
+// registered in init() or early in main() before Dispatch().  It panics if
+// name is already registered.
+func Register(name string, fn Entrypoint) {
+	entrypoints.Lock()
+	defer entrypoints.Unlock()
+
+	if _, ok := entrypoints.fns[name]; ok {
+		panic(fmt.Sprintf("sandbox: entrypoint %s is already registered", name))
+	}
+	entrypoints.fns[name] = fn
+}
+
+// Entry adapts a typed function to an Entrypoint.
+func Entry[P any, R any](fn func(P) (R, error)) Entrypoint {
+	return func(args json.RawMessage) (any, error) {
+		var p P
+		if len(args) > 0 {
+			err := json.Unmarshal(args, &p)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return fn(p)
+	}
+}
+
+func entrypoint(name string) (Entrypoint, error) {
+	entrypoints.RLock()
+	defer entrypoints.RUnlock()
+
+	fn, ok := entrypoints.fns[name]
+	if !ok {
+		return nil, errors.Errorf("sandbox: entrypoint %s is not registered", name)
+	}
+	return fn, nil
+}
+
+// Run re-executes the current program in a bubblewrap sandbox and calls the
+// entrypoint registered as name with args.  The program must call Dispatch()
+// to handle the entrypoint in the sandbox.  opts.Command is ignored, and the
+// handlers in opts.RPC are available to the sandbox along with the ones used
+// by Run().
+//
+// If the current process is already sandboxed, the entrypoint is called
+// directly.
+func Run[R any](name string, args any, opts *BubblewrapOptions) (R, error) {
+	var result R
+
+	fn, err := entrypoint(name)
+	if err != nil {
+		return result, err
+	}
+
+	data, err := json.Marshal(args)
+	if err != nil {
+		return result, err
+	}
+
+	var out entrypointResult
+	if IsSandboxed() {
+		log.Debugf("sandbox: %s: already sandboxed", name)
+		out = callEntrypoint(fn, data)
+	} else {
+		out, err = runEntrypoint(name, data, opts)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	// The error is provided by the sandboxed process, so it's untrusted.
+	if out.Error != "" {
+		return result, errors.Errorf("%s: %s", name, stringx.Sanitize(out.Error))
+	}
+
+	if len(out.Result) > 0 {
+		err = json.Unmarshal(out.Result, &result)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+func runEntrypoint(name string, args json.RawMessage, opts *BubblewrapOptions) (entrypointResult, error) {
+	var result entrypointResult
+	var mu sync.Mutex
+	done := false
+
+	o := *opts
+	o.Command = nil
+	if o.RPC == nil {
+		o.RPC = rpc.NewMux()
+	} else {
+		o.RPC = o.RPC.Clone()
+	}
+
+	o.RPC.Handle(argsMethod, rpc.Func(func(any) (json.RawMessage, error) {
+		return args, nil
+	}))
+	o.RPC.Handle(resultMethod, rpc.Func(func(r entrypointResult) (any, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if done {
+			return nil, errors.Errorf("result already received")
+		}
+		result = r
+		done = true
+		return nil, nil
+	}))
+
+	b, err := NewBubblewrap(&o)
+	if err != nil {
+		return result, err
+	}
+	b.entrypoint = name
+
+	log.Debugf("sandbox: running %s", name)
+	err = b.run()
+	if err != nil {
+		return result, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if !done {
+		return result, errors.Errorf("sandbox: %s exited without a result", name)
+	}
+	return result, nil
+}
+
+func callEntrypoint(fn Entrypoint, args json.RawMessage) entrypointResult {
+	r, err := fn(args)
+	if err != nil {
+		return entrypointResult{Error: err.Error()}
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return entrypointResult{Error: err.Error()}
+	}
+	return entrypointResult{Result: data}
+}
+
+// Dispatch calls the entrypoint that the sandbox was started for by Run()
+// and exits.  It returns immediately in other processes, so it should be
+// called early in main() after the entrypoints are registered.
+func Dispatch() {
+	name := os.Getenv(entrypointEnv)
+	if name == "" || !IsSandboxed() {
+		return
+	}
+
+	err := dispatch(name)
+	if err != nil {
+		log.Errorf("sandbox: %s: %v", name, err)
+		os.Exit(1) // revive:disable-line
+	}
+	os.Exit(0) // revive:disable-line
+}
+
+func dispatch(name string) error {
+	conn, err := RPC(nil)
+	if err != nil {
+		return err
+	}
+
+	var args json.RawMessage
+	_, err = conn.Call(argsMethod, nil, &args)
+	if err != nil {
+		return errorx.Join(err, conn.Close())
+	}
+
+	var out entrypointResult
+	fn, err := entrypoint(name)
+	if err != nil {
+		out = entrypointResult{Error: err.Error()}
+	} else {
+		out = callEntrypoint(fn, args)
+	}
+
+	_, err = conn.Call(resultMethod, &out, nil)
+	return errorx.Join(err, conn.Close())
+}
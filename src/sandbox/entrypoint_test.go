@@ -0,0 +1,102 @@
+//go:build linux
+
+package sandbox_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/illikainen/go-utils/src/iofs"
+	"github.com/illikainen/go-utils/src/sandbox"
+	"github.com/illikainen/go-utils/src/test"
+
+	"github.com/pkg/errors"
+)
+
+type upperArgs struct {
+	Value string `json:"value"`
+}
+
+func init() {
+	sandbox.Register("upper", sandbox.Entry(func(args upperArgs) (string, error) {
+		if args.Value == "" {
+			return "", errors.Errorf("empty value")
+		}
+		return strings.ToUpper(args.Value), nil
+	}))
+
+	sandbox.Register("escape", sandbox.Entry(func(args upperArgs) (string, error) {
+		return "", errors.Errorf("%s", args.Value)
+	}))
+}
+
+func TestMain(m *testing.M) {
+	sandbox.Dispatch()
+	os.Exit(m.Run())
+}
+
+// fakeBubblewrap puts a bwrap in PATH that runs the test binary without a
+// sandbox, so that the entrypoint protocol can be tested without user
+// namespaces.
+func fakeBubblewrap(t *testing.T) {
+	t.Helper()
+
+	bin, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	script := `#!/bin/sh
+while [ "$#" -gt 0 ] && [ "$1" != "$GO_SANDBOX_TEST_BIN" ]; do shift; done
+exec "$@"
+`
+	err = iofs.WriteFile(filepath.Join(dir, "bwrap"), strings.NewReader(script))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Chmod(filepath.Join(dir, "bwrap"), 0700) // #nosec G302
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("GO_SANDBOX_TEST_BIN", bin)
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestRun(t *testing.T) {
+	fakeBubblewrap(t)
+
+	result, err := sandbox.Run[string]("upper", &upperArgs{Value: "foo"}, &sandbox.BubblewrapOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, result, "FOO")
+
+	_, err = sandbox.Run[string]("upper", &upperArgs{}, &sandbox.BubblewrapOptions{})
+	test.AssertNe(t, err, nil)
+	test.AssertEq(t, strings.Contains(err.Error(), "empty value"), true)
+
+	_, err = sandbox.Run[string]("missing", nil, &sandbox.BubblewrapOptions{})
+	test.AssertNe(t, err, nil)
+}
+
+func TestRunSanitizeError(t *testing.T) {
+	fakeBubblewrap(t)
+
+	_, err := sandbox.Run[string]("escape", &upperArgs{Value: "foo\x1b]0;bar\x07"}, &sandbox.BubblewrapOptions{})
+	test.AssertNe(t, err, nil)
+	test.AssertEq(t, strings.ContainsAny(err.Error(), "\x1b\x07"), false)
+	test.AssertEq(t, strings.Contains(err.Error(), "foo"), true)
+}
+
+func TestRegisterDuplicate(t *testing.T) {
+	defer func() {
+		test.AssertNe(t, recover(), nil)
+	}()
+
+	sandbox.Register("upper", nil)
+}
@@ -0,0 +1,93 @@
+package sandbox
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/illikainen/go-utils/src/errorx"
+
+	"github.com/pkg/errors"
+)
+
+const filesEnv = "GO_SANDBOX_FILES"
+
+type namedFile struct {
+	name  string
+	file  *os.File
+	owned bool
+}
+
+var inheritedFiles = struct {
+	sync.Mutex
+	taken map[string]bool
+}{taken: map[string]bool{}}
+
+// AddFile passes an open file into the sandbox as an inherited file
+// descriptor.  Unlike bind mounts, neither the path of the file nor its
+// siblings are visible in the sandbox.  The flag is one of os.O_RDONLY,
+// os.O_WRONLY or os.O_RDWR.  If f has more access than flag, it's reopened
+// with the narrower access mode where supported.  A reopened file starts at
+// the current offset of f and retains O_APPEND, but it has an offset of its
+// own, so reads and writes in the sandbox don't move the offset of f.  The
+// sandboxed process retrieves the file with File().
+func (b *Bubblewrap) AddFile(name string, f *os.File, flag int) error {
+	if name == "" || strings.ContainsAny(name, "=,") {
+		return errors.Errorf("bubblewrap: invalid file name: %s", name)
+	}
+
+	for _, cur := range b.files {
+		if cur.name == name {
+			return errors.Errorf("bubblewrap: duplicate file name: %s", name)
+		}
+	}
+
+	narrowed, err := narrowFile(f, flag)
+	if err != nil {
+		return errors.Wrapf(err, "bubblewrap: %s", name)
+	}
+
+	b.files = append(b.files, &namedFile{name: name, file: narrowed, owned: narrowed != f})
+	return nil
+}
+
+// closeFiles closes the files that were reopened by AddFile().  The files
+// that were passed by the caller are left open.
+func (b *Bubblewrap) closeFiles() error {
+	var errs error
+	for _, nf := range b.files {
+		if nf.owned {
+			errs = errorx.Join(errs, nf.file.Close())
+		}
+	}
+	return errs
+}
+
+// File returns a file that was passed into the sandbox with AddFile().  Each
+// file can only be retrieved once.
+func File(name string) (*os.File, error) {
+	inheritedFiles.Lock()
+	defer inheritedFiles.Unlock()
+
+	if inheritedFiles.taken[name] {
+		return nil, errors.Errorf("%s has already been retrieved", name)
+	}
+
+	for _, entry := range strings.Split(os.Getenv(filesEnv), ",") {
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok || key != name {
+			continue
+		}
+
+		fd, err := strconv.Atoi(value)
+		if err != nil || fd < 3 {
+			return nil, errors.Errorf("invalid fd for %s: %s", name, value)
+		}
+
+		inheritedFiles.taken[name] = true
+		return os.NewFile(uintptr(fd), name), nil
+	}
+
+	return nil, errors.Wrap(os.ErrNotExist, name)
+}
@@ -0,0 +1,53 @@
+package sandbox
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/illikainen/go-utils/src/errorx"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// narrowFile reopens f through procfs if it has more access than flag.  The
+// reopened file starts at the current offset of f and retains O_APPEND, but
+// its offset is independent of f afterwards.
+func narrowFile(f *os.File, flag int) (*os.File, error) {
+	want := flag & unix.O_ACCMODE
+
+	cur, err := unix.FcntlInt(f.Fd(), unix.F_GETFL, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if cur&unix.O_ACCMODE == want {
+		return f, nil
+	}
+
+	if cur&unix.O_ACCMODE != unix.O_RDWR {
+		return nil, errors.Errorf("insufficient access mode")
+	}
+
+	offset, err := unix.Seek(int(f.Fd()), 0, unix.SEEK_CUR)
+	seekable := err == nil
+	if err != nil && !errors.Is(err, unix.ESPIPE) {
+		return nil, err
+	}
+
+	path := fmt.Sprintf("/proc/self/fd/%d", f.Fd())
+	narrowed, err := os.OpenFile(path, want|cur&unix.O_APPEND|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if seekable {
+		_, err := narrowed.Seek(offset, io.SeekStart)
+		if err != nil {
+			return nil, errorx.Join(err, narrowed.Close())
+		}
+	}
+
+	return narrowed, nil
+}
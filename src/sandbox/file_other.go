@@ -0,0 +1,13 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"os"
+)
+
+// narrowFile returns f as-is because the access mode can't be narrowed on
+// this platform.
+func narrowFile(f *os.File, _ int) (*os.File, error) {
+	return f, nil
+}
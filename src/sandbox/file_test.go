@@ -0,0 +1,71 @@
+//go:build linux
+
+package sandbox_test
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/illikainen/go-utils/src/sandbox"
+	"github.com/illikainen/go-utils/src/test"
+)
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input")
+	err := os.WriteFile(path, []byte("foo"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path) // #nosec G304
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close() // revive:disable-line
+
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GO_SANDBOX_FILES", fmt.Sprintf("input=%d", fd))
+
+	_, err = sandbox.File("missing")
+	test.AssertNe(t, err, nil)
+
+	inherited, err := sandbox.File("input")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := io.ReadAll(inherited)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, string(data), "foo")
+	test.AssertEq(t, inherited.Close(), nil)
+
+	_, err = sandbox.File("input")
+	test.AssertNe(t, err, nil)
+}
+
+func TestAddFile(t *testing.T) {
+	b, err := sandbox.NewBubblewrap(&sandbox.BubblewrapOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close() // revive:disable-line
+
+	test.AssertEq(t, b.AddFile("null", f, os.O_RDONLY), nil)
+	test.AssertNe(t, b.AddFile("null", f, os.O_RDONLY), nil)
+	test.AssertNe(t, b.AddFile("a=b", f, os.O_RDONLY), nil)
+	test.AssertNe(t, b.AddFile("rw", f, os.O_RDWR), nil)
+}
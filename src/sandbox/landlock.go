@@ -0,0 +1,171 @@
+package sandbox
+
+import (
+	"io"
+	"path/filepath"
+
+	"github.com/illikainen/go-utils/src/iofs"
+	"github.com/illikainen/go-utils/src/process"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type LandlockOptions struct {
+	ReadOnlyPaths    []string
+	ReadWritePaths   []string
+	DevPaths         []string
+	AllowCommonPaths bool
+	ShareNet         bool
+}
+
+// Landlock confines the current process (and any future children) in place
+// with the Landlock LSM.  Unlike Bubblewrap, it doesn't need user namespaces
+// and therefore works in most containers.  Note that network restrictions
+// only apply to TCP and require Landlock ABI v4.
+type Landlock struct {
+	*LandlockOptions
+	readOnlyPaths  []string
+	readWritePaths []string
+	devPaths       []string
+	confined       bool
+}
+
+func NewLandlock(opts *LandlockOptions) (*Landlock, error) {
+	if LandlockABI() < 1 {
+		return nil, errors.Errorf("landlock is not supported")
+	}
+
+	l := &Landlock{LandlockOptions: opts}
+
+	err := l.AddReadWritePath(opts.ReadWritePaths...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = l.AddReadOnlyPath(opts.ReadOnlyPaths...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = l.AddDevPath(opts.DevPaths...)
+	if err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *Landlock) AddReadOnlyPath(path ...string) error {
+	for _, cur := range path {
+		if cur != "" {
+			p, err := expand(cur)
+			if err != nil {
+				return errors.Wrapf(err, "landlock: %s", cur)
+			}
+
+			exists, err := iofs.Exists(p)
+			if err != nil {
+				return err
+			}
+			if exists {
+				l.readOnlyPaths = append(l.readOnlyPaths, p)
+			}
+		}
+	}
+	return nil
+}
+
+func (l *Landlock) AddReadWritePath(path ...string) error {
+	for _, cur := range path {
+		if cur != "" {
+			p, err := expand(cur)
+			if err != nil {
+				return errors.Wrapf(err, "landlock: %s", cur)
+			}
+
+			exists, err := iofs.Exists(p)
+			if err != nil {
+				return err
+			}
+
+			for !exists {
+				p = filepath.Dir(p)
+				exists, err = iofs.Exists(p)
+				if err != nil {
+					return err
+				}
+			}
+
+			l.readWritePaths = append(l.readWritePaths, p)
+		}
+	}
+	return nil
+}
+
+func (l *Landlock) AddDevPath(path ...string) error {
+	for _, cur := range path {
+		if cur != "" {
+			p, err := expand(cur)
+			if err != nil {
+				return errors.Wrapf(err, "landlock: %s", cur)
+			}
+
+			exists, err := iofs.Exists(p)
+			if err != nil {
+				return err
+			}
+			if exists {
+				l.devPaths = append(l.devPaths, p)
+			}
+		}
+	}
+	return nil
+}
+
+func (l *Landlock) SetShareNet(value bool) {
+	l.ShareNet = value
+}
+
+// SetStdin is a no-op because Landlock confines the current process rather
+// than a subprocess.
+func (l *Landlock) SetStdin(io.Reader) {
+}
+
+// SetStdout is a no-op because Landlock confines the current process rather
+// than a subprocess.
+func (l *Landlock) SetStdout(process.OutputFunc) {
+}
+
+// SetStderr is a no-op because Landlock confines the current process rather
+// than a subprocess.
+func (l *Landlock) SetStderr(process.OutputFunc) {
+}
+
+func (l *Landlock) Confine() error {
+	if l.confined {
+		return nil
+	}
+
+	ro := l.readOnlyPaths
+	if l.AllowCommonPaths {
+		for _, path := range commonPaths {
+			exists, err := iofs.Exists(path)
+			if err != nil {
+				return err
+			}
+			if exists {
+				ro = append(ro, path)
+			}
+		}
+	}
+
+	err := landlockRestrict(ro, l.readWritePaths, l.devPaths, l.ShareNet)
+	if err != nil {
+		return err
+	}
+
+	l.confined = true
+	log.Debug("landlock: confined")
+	return nil
+}
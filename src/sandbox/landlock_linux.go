@@ -0,0 +1,210 @@
+package sandbox
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/illikainen/go-utils/src/errorx"
+	"github.com/illikainen/go-utils/src/seq"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// Access rights that are valid for path-beneath rules on non-directories.
+const landlockFileAccess = unix.LANDLOCK_ACCESS_FS_EXECUTE |
+	unix.LANDLOCK_ACCESS_FS_WRITE_FILE |
+	unix.LANDLOCK_ACCESS_FS_READ_FILE |
+	unix.LANDLOCK_ACCESS_FS_TRUNCATE |
+	unix.LANDLOCK_ACCESS_FS_IOCTL_DEV
+
+const landlockReadAccess = unix.LANDLOCK_ACCESS_FS_EXECUTE |
+	unix.LANDLOCK_ACCESS_FS_READ_FILE |
+	unix.LANDLOCK_ACCESS_FS_READ_DIR
+
+var allThreadsOnce sync.Once
+var allThreadsSupported bool
+
+// allThreadsSyscall checks whether AllThreadsSyscall() is supported with a
+// harmless syscall.
+func allThreadsSyscall() bool {
+	allThreadsOnce.Do(func() {
+		_, _, errno := syscall.AllThreadsSyscall(unix.SYS_GETPID, 0, 0, 0)
+		allThreadsSupported = errno == 0
+	})
+	return allThreadsSupported
+}
+
+// LandlockABI returns the Landlock ABI version supported by the kernel, or 0
+// if Landlock is unavailable, disabled or can't be applied by the current
+// binary.  The ruleset has to be applied to every thread with
+// AllThreadsSyscall(), which is unsupported in binaries built with cgo.
+func LandlockABI() int {
+	if os.Getenv(disableEnv) == "1" || !allThreadsSyscall() {
+		return 0
+	}
+
+	abi, _, errno := unix.Syscall(
+		unix.SYS_LANDLOCK_CREATE_RULESET,
+		0,
+		0,
+		unix.LANDLOCK_CREATE_RULESET_VERSION,
+	)
+	if errno != 0 {
+		return 0
+	}
+	return int(abi)
+}
+
+func landlockFsAccess(abi int) uint64 {
+	access := uint64(unix.LANDLOCK_ACCESS_FS_EXECUTE |
+		unix.LANDLOCK_ACCESS_FS_WRITE_FILE |
+		unix.LANDLOCK_ACCESS_FS_READ_FILE |
+		unix.LANDLOCK_ACCESS_FS_READ_DIR |
+		unix.LANDLOCK_ACCESS_FS_REMOVE_DIR |
+		unix.LANDLOCK_ACCESS_FS_REMOVE_FILE |
+		unix.LANDLOCK_ACCESS_FS_MAKE_CHAR |
+		unix.LANDLOCK_ACCESS_FS_MAKE_DIR |
+		unix.LANDLOCK_ACCESS_FS_MAKE_REG |
+		unix.LANDLOCK_ACCESS_FS_MAKE_SOCK |
+		unix.LANDLOCK_ACCESS_FS_MAKE_FIFO |
+		unix.LANDLOCK_ACCESS_FS_MAKE_BLOCK |
+		unix.LANDLOCK_ACCESS_FS_MAKE_SYM)
+
+	if abi >= 2 {
+		access |= unix.LANDLOCK_ACCESS_FS_REFER
+	}
+	if abi >= 3 {
+		access |= unix.LANDLOCK_ACCESS_FS_TRUNCATE
+	}
+	if abi >= 5 {
+		access |= unix.LANDLOCK_ACCESS_FS_IOCTL_DEV
+	}
+	return access
+}
+
+func landlockRestrict(ro []string, rw []string, dev []string, shareNet bool) (err error) {
+	abi := LandlockABI()
+	if abi < 1 {
+		return errors.Errorf("landlock is not supported")
+	}
+
+	fsAccess := landlockFsAccess(abi)
+	attr := unix.LandlockRulesetAttr{Access_fs: fsAccess}
+
+	if !shareNet {
+		if abi >= 4 {
+			// No port rules are added, so every TCP bind() and
+			// connect() is denied.
+			attr.Access_net = unix.LANDLOCK_ACCESS_NET_BIND_TCP | unix.LANDLOCK_ACCESS_NET_CONNECT_TCP
+		} else {
+			log.Warnf("landlock: ABI v%d can't restrict network access", abi)
+		}
+	} else {
+		log.Debug("landlock: net enabled")
+	}
+
+	fd, _, errno := unix.Syscall(
+		unix.SYS_LANDLOCK_CREATE_RULESET,
+		uintptr(unsafe.Pointer(&attr)), // #nosec G103
+		unsafe.Sizeof(attr),
+		0,
+	)
+	if errno != 0 {
+		return errors.Wrap(errno, "landlock: create ruleset")
+	}
+	defer errorx.Defer(func() error { return unix.Close(int(fd)) }, &err)
+
+	paths := []string{}
+	for _, path := range rw {
+		if !seq.Contains(paths, path) {
+			err := landlockAddPath(int(fd), path, fsAccess&^unix.LANDLOCK_ACCESS_FS_IOCTL_DEV)
+			if err != nil {
+				return err
+			}
+			log.Debugf("landlock: rw: %s", path)
+			paths = append(paths, path)
+		}
+	}
+
+	for _, path := range ro {
+		if !seq.Contains(paths, path) {
+			err := landlockAddPath(int(fd), path, fsAccess&landlockReadAccess)
+			if err != nil {
+				return err
+			}
+			log.Debugf("landlock: ro: %s", path)
+			paths = append(paths, path)
+		}
+	}
+
+	for _, path := range dev {
+		if !seq.Contains(paths, path) {
+			err := landlockAddPath(int(fd), path, fsAccess)
+			if err != nil {
+				return err
+			}
+			log.Debugf("landlock: dev: %s", path)
+			paths = append(paths, path)
+		}
+	}
+
+	// Landlock applies to the calling thread, so both no_new_privs and
+	// the ruleset have to be applied to every thread in the Go runtime.
+	// Note that AllThreadsSyscall() is unsupported if cgo is enabled.
+	_, _, errno = syscall.AllThreadsSyscall(unix.SYS_PRCTL, unix.PR_SET_NO_NEW_PRIVS, 1, 0)
+	if errno == syscall.ENOTSUP {
+		return errors.Errorf("landlock: unsupported in binaries built with cgo")
+	}
+	if errno != 0 {
+		return errors.Wrap(errno, "landlock: no_new_privs")
+	}
+
+	_, _, errno = syscall.AllThreadsSyscall(unix.SYS_LANDLOCK_RESTRICT_SELF, fd, 0, 0)
+	if errno != 0 {
+		return errors.Wrap(errno, "landlock: restrict self")
+	}
+
+	return nil
+}
+
+func landlockAddPath(ruleset int, path string, access uint64) (err error) {
+	fd, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return errors.Wrapf(err, "landlock: %s", path)
+	}
+	defer errorx.Defer(func() error { return unix.Close(fd) }, &err)
+
+	var stat unix.Stat_t
+	err = unix.Fstat(fd, &stat)
+	if err != nil {
+		return errors.Wrapf(err, "landlock: %s", path)
+	}
+
+	if stat.Mode&unix.S_IFMT != unix.S_IFDIR {
+		access &= landlockFileAccess
+	}
+
+	attr := unix.LandlockPathBeneathAttr{
+		Allowed_access: access,
+		Parent_fd:      int32(fd), // #nosec G115
+	}
+
+	_, _, errno := unix.Syscall6(
+		unix.SYS_LANDLOCK_ADD_RULE,
+		uintptr(ruleset),
+		unix.LANDLOCK_RULE_PATH_BENEATH,
+		uintptr(unsafe.Pointer(&attr)), // #nosec G103
+		0,
+		0,
+		0,
+	)
+	if errno != 0 {
+		return errors.Wrapf(errno, "landlock: %s", path)
+	}
+
+	return nil
+}
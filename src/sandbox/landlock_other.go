@@ -0,0 +1,17 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+func LandlockABI() int {
+	return 0
+}
+
+func landlockRestrict([]string, []string, []string, bool) error {
+	return errors.Errorf("landlock: %s is not supported", runtime.GOOS)
+}
@@ -0,0 +1,150 @@
+//go:build linux
+
+package sandbox_test
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/illikainen/go-utils/src/iofs"
+	"github.com/illikainen/go-utils/src/sandbox"
+	"github.com/illikainen/go-utils/src/test"
+
+	"github.com/pkg/errors"
+)
+
+const landlockTestEnv = "GO_SANDBOX_TEST_LANDLOCK"
+
+func TestLandlockBackend(t *testing.T) {
+	// Landlock is only selected if the ruleset can be applied, which
+	// isn't the case in binaries built with cgo.
+	if !sandbox.Compatible() {
+		backend, err := sandbox.Backend("")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if sandbox.LandlockABI() > 0 {
+			test.AssertEq(t, backend, sandbox.LandlockSandbox)
+		} else {
+			test.AssertEq(t, backend, sandbox.NoSandbox)
+		}
+	}
+
+	t.Setenv("GO_SANDBOX_DISABLE", "1")
+	test.AssertEq(t, sandbox.LandlockABI(), 0)
+
+	backend, err := sandbox.Backend("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, backend, sandbox.NoSandbox)
+
+	_, err = sandbox.NewLandlock(&sandbox.LandlockOptions{})
+	test.AssertNe(t, err, nil)
+}
+
+func TestLandlockPaths(t *testing.T) {
+	if sandbox.LandlockABI() < 1 {
+		t.Skip("landlock is unavailable")
+	}
+
+	dir := t.TempDir()
+
+	// Missing read-only paths are skipped, and missing read-write paths
+	// are replaced by their nearest existing parent.
+	_, err := sandbox.NewLandlock(&sandbox.LandlockOptions{
+		ReadOnlyPaths:  []string{filepath.Join(dir, "missing")},
+		ReadWritePaths: []string{filepath.Join(dir, "missing", "dir")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = sandbox.NewLandlock(&sandbox.LandlockOptions{ReadOnlyPaths: []string{"/"}})
+	test.AssertNe(t, err, nil)
+}
+
+// TestLandlockConfine confines a copy of the test binary, because a
+// Landlock ruleset can't be removed from the process once it's applied.
+func TestLandlockConfine(t *testing.T) {
+	if os.Getenv(landlockTestEnv) != "" {
+		landlockChild(t)
+		return
+	}
+
+	if sandbox.LandlockABI() < 1 {
+		t.Skip("landlock is unavailable")
+	}
+
+	ro := t.TempDir()
+	rw := t.TempDir()
+	denied := t.TempDir()
+	writeFile(t, filepath.Join(ro, "file"), "ro")
+	writeFile(t, filepath.Join(denied, "file"), "denied")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		test.AssertEq(t, ln.Close(), nil)
+	}()
+
+	bin, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(bin, "-test.run=^TestLandlockConfine$", "-test.v") // #nosec G204
+	cmd.Env = append(os.Environ(), landlockTestEnv+"="+strings.Join([]string{ro, rw, denied,
+		ln.Addr().String()}, string(os.PathListSeparator)))
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+}
+
+func landlockChild(t *testing.T) {
+	args := strings.Split(os.Getenv(landlockTestEnv), string(os.PathListSeparator))
+	ro, rw, denied, addr := args[0], args[1], args[2], args[3]
+
+	l, err := sandbox.NewLandlock(&sandbox.LandlockOptions{
+		ReadOnlyPaths:  []string{ro},
+		ReadWritePaths: []string{filepath.Join(rw, "dir")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = l.Confine()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := iofs.ReadFile(filepath.Join(ro, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, string(data), "ro")
+
+	err = iofs.WriteFile(filepath.Join(ro, "new"), strings.NewReader("x"))
+	test.AssertEq(t, errors.Is(err, os.ErrPermission), true)
+
+	err = iofs.WriteFile(filepath.Join(rw, "dir", "new"), strings.NewReader("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = iofs.ReadFile(filepath.Join(denied, "file"))
+	test.AssertEq(t, errors.Is(err, os.ErrPermission), true)
+
+	if sandbox.LandlockABI() >= 4 {
+		_, err = net.Dial("tcp", addr)
+		test.AssertNe(t, err, nil)
+	}
+}
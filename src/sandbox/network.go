@@ -0,0 +1,166 @@
+package sandbox
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/illikainen/go-utils/src/errorx"
+	"github.com/illikainen/go-utils/src/rpc"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const dialMethod = "sandbox.dial"
+
+// DefaultDialTimeout is used if NetworkProxy.Timeout is zero.
+const DefaultDialTimeout = 30 * time.Second
+
+// NetworkProxy gives a sandbox without network access connections to an
+// allowlist of destinations.  The parent dials the destinations and passes
+// the connected sockets to the sandbox over the RPC channel, so the sandbox
+// keeps its own network namespace.  Destinations are host:port pairs where
+// both parts may contain path.Match() patterns, e.g. *.example.com:443.
+// Hostnames are resolved by the parent.
+type NetworkProxy struct {
+	Allow   []string
+	Timeout time.Duration
+}
+
+type dialParams struct {
+	Network string `json:"network"`
+	Address string `json:"address"`
+}
+
+// Register adds the proxy to the RPC mux of a sandbox.
+func (n *NetworkProxy) Register(mux *rpc.Mux) {
+	mux.Handle(dialMethod, n.dial)
+}
+
+func (n *NetworkProxy) dial(params json.RawMessage, files []*os.File) (any, []*os.File, error) {
+	err := closeAll(files)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var p dialParams
+	err = json.Unmarshal(params, &p)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if p.Network != "tcp" && p.Network != "tcp4" && p.Network != "tcp6" {
+		return nil, nil, errors.Errorf("proxy: unsupported network: %s", p.Network)
+	}
+
+	ok, err := n.Permits(p.Address)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		log.Debugf("proxy: denied %s", p.Address)
+		return nil, nil, errors.Errorf("proxy: %s is not allowed", p.Address)
+	}
+
+	timeout := n.Timeout
+	if timeout == 0 {
+		timeout = DefaultDialTimeout
+	}
+
+	log.Debugf("proxy: connecting to %s", p.Address)
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := dialer.Dial(p.Network, p.Address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tcp, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil, nil, errorx.Join(errors.Errorf("proxy: unexpected connection"), conn.Close())
+	}
+
+	f, err := tcp.File()
+	err = errorx.Join(err, tcp.Close())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return nil, []*os.File{f}, nil
+}
+
+// Permits checks whether address is in the allowlist.
+func (n *NetworkProxy) Permits(address string) (bool, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	host = strings.ToLower(host)
+
+	for _, allowed := range n.Allow {
+		allowedHost, allowedPort, err := net.SplitHostPort(allowed)
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+
+		hostOk, err := path.Match(strings.ToLower(allowedHost), host)
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+
+		portOk, err := path.Match(allowedPort, port)
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+
+		if hostOk && portOk {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Dial connects to address through the NetworkProxy of the parent.  It's
+// used in the sandbox with the connection from RPC().
+func Dial(conn *rpc.Conn, network string, address string) (net.Conn, error) {
+	files, err := conn.Call(dialMethod, &dialParams{Network: network, Address: address}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) != 1 {
+		return nil, errorx.Join(errors.Errorf("proxy: unexpected number of files"), closeAll(files))
+	}
+
+	c, err := net.FileConn(files[0])
+	err = errorx.Join(err, files[0].Close())
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Dialer returns a function that can be used as the DialContext of an
+// http.Transport in the sandbox.
+func Dialer(conn *rpc.Conn) func(context.Context, string, string) (net.Conn, error) {
+	return func(ctx context.Context, network string, address string) (net.Conn, error) {
+		err := ctx.Err()
+		if err != nil {
+			return nil, err
+		}
+		return Dial(conn, network, address)
+	}
+}
+
+func closeAll(files []*os.File) error {
+	var errs error
+	for _, f := range files {
+		errs = errorx.Join(errs, f.Close())
+	}
+	return errs
+}
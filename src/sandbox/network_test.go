@@ -0,0 +1,101 @@
+package sandbox_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/illikainen/go-utils/src/rpc"
+	"github.com/illikainen/go-utils/src/sandbox"
+	"github.com/illikainen/go-utils/src/test"
+)
+
+func TestNetworkProxy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprint(w, "hello")
+	}))
+	defer server.Close()
+
+	addr := strings.TrimPrefix(server.URL, "http://")
+	proxy := &sandbox.NetworkProxy{Allow: []string{addr}}
+
+	mux := rpc.NewMux()
+	proxy.Register(mux)
+
+	f, uc, err := rpc.Socketpair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parent := rpc.NewConn(uc, mux)
+	child, err := rpc.FileConn(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = parent.Serve() }()
+	go func() { _ = child.Serve() }()
+	defer func() {
+		_ = parent.Close()
+		_ = child.Close()
+	}()
+
+	client := &http.Client{Transport: &http.Transport{DialContext: sandbox.Dialer(child)}}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, string(body), "hello")
+
+	_, err = sandbox.Dial(child, "tcp", "127.0.0.1:1")
+	test.AssertNe(t, err, nil)
+
+	_, err = sandbox.Dial(child, "udp", addr)
+	test.AssertNe(t, err, nil)
+}
+
+func TestNetworkProxyPermits(t *testing.T) {
+	proxy := &sandbox.NetworkProxy{Allow: []string{"*.example.com:443", "registry.local:*"}}
+
+	for address, expected := range map[string]bool{
+		"pkg.example.com:443": true,
+		"PKG.EXAMPLE.COM:443": true,
+		"pkg.example.com:80":  false,
+		"example.com:443":     false,
+		"registry.local:5000": true,
+		"other.local:5000":    false,
+	} {
+		ok, err := proxy.Permits(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.AssertEq(t, ok, expected)
+	}
+
+	_, err := proxy.Permits("missing-port")
+	test.AssertNe(t, err, nil)
+
+	_, err = sandbox.NewBubblewrap(&sandbox.BubblewrapOptions{Network: proxy, ShareNet: true})
+	test.AssertNe(t, err, nil)
+
+	opts := &sandbox.BubblewrapOptions{Command: []string{"true"}, Network: proxy}
+	for i := 0; i < 2; i++ {
+		b, err := sandbox.NewBubblewrap(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.AssertEq(t, b.RPC == nil, false)
+		test.AssertEq(t, opts.RPC, (*rpc.Mux)(nil))
+	}
+}
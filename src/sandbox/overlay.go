@@ -0,0 +1,292 @@
+package sandbox
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/illikainen/go-utils/src/iofs"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	ChangeAdded    = "added"
+	ChangeModified = "modified"
+	ChangeDeleted  = "deleted"
+)
+
+// Change is a modification made in an overlay.  Path is relative to the
+// overlaid directory.
+type Change struct {
+	Kind string `json:"kind"`
+	Path string `json:"path"`
+}
+
+// Overlay is a copy-on-write view of a host directory.  The directory is
+// writable in the sandbox, but writes end up in Dir/upper instead of the host
+// directory.  If Dir is empty, writes end up in a tmpfs that's discarded when
+// the sandbox exits.
+type Overlay struct {
+	Path string
+	Dir  string
+}
+
+// NewOverlay creates an overlay for path.  The upper and work directories are
+// created in dir unless it's empty.  Both must be on the same filesystem, so
+// dir shouldn't be a tmpfs if the changes are to survive the sandbox.
+func NewOverlay(path string, dir string) (*Overlay, error) {
+	p, err := expand(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "overlay: %s", path)
+	}
+
+	stat, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if !stat.IsDir() {
+		return nil, errors.Errorf("overlay: %s is not a directory", p)
+	}
+
+	o := &Overlay{Path: p}
+	if dir != "" {
+		o.Dir, err = iofs.Expand(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, d := range []string{o.upper(), o.work()} {
+			err := os.MkdirAll(d, 0700)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return o, nil
+}
+
+func (o *Overlay) upper() string {
+	return filepath.Join(o.Dir, "upper")
+}
+
+func (o *Overlay) work() string {
+	return filepath.Join(o.Dir, "work")
+}
+
+func (o *Overlay) args() []string {
+	if o.Dir == "" {
+		return []string{"--overlay-src", o.Path, "--tmp-overlay", o.Path}
+	}
+	return []string{"--overlay-src", o.Path, "--overlay", o.upper(), o.work(), o.Path}
+}
+
+// Diff returns the changes in the upper directory of the overlay, sorted by
+// path.  The content of added and modified directories isn't compared, so a
+// directory is only listed if it didn't exist in the host directory.
+func (o *Overlay) Diff() ([]Change, error) {
+	if o.Dir == "" {
+		return nil, errors.Errorf("overlay: %s: changes are discarded without a directory", o.Path)
+	}
+
+	changes := []Change{}
+	upper := o.upper()
+
+	err := filepath.WalkDir(upper, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(upper, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if isWhiteout(info) {
+			changes = append(changes, Change{Kind: ChangeDeleted, Path: rel})
+			return nil
+		}
+
+		lower := filepath.Join(o.Path, rel)
+		lowerInfo, err := os.Lstat(lower)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		switch {
+		case lowerInfo == nil:
+			changes = append(changes, Change{Kind: ChangeAdded, Path: rel})
+		case !d.IsDir() || !lowerInfo.IsDir():
+			changes = append(changes, Change{Kind: ChangeModified, Path: rel})
+		case isOpaque(path):
+			deleted, err := opaqueDeletions(path, lower, rel)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, deleted...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(changes, func(i int, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
+
+// opaqueDeletions returns the entries in the host directory lower that are
+// hidden by the opaque upper directory.
+func opaqueDeletions(upper string, lower string, rel string) ([]Change, error) {
+	entries, err := os.ReadDir(lower)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []Change{}
+	for _, entry := range entries {
+		exists, err := lexists(filepath.Join(upper, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			changes = append(changes, Change{Kind: ChangeDeleted, Path: filepath.Join(rel, entry.Name())})
+		}
+	}
+	return changes, nil
+}
+
+// Apply writes the changes to the host directory.  It's meant to be used
+// with a reviewed subset of the changes from Diff().
+func (o *Overlay) Apply(changes []Change) error {
+	if o.Dir == "" {
+		return errors.Errorf("overlay: %s: changes are discarded without a directory", o.Path)
+	}
+
+	for _, change := range changes {
+		rel := filepath.Clean(change.Path)
+		if filepath.IsAbs(rel) || rel == "." || rel == ".." ||
+			strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return errors.Errorf("overlay: invalid path: %s", change.Path)
+		}
+
+		// The sandbox controls the upper directory, and earlier changes
+		// may have created symlinks in the host directory, so neither
+		// side may be reached through a symlink.
+		err := checkParents(o.Path, rel)
+		if err != nil {
+			return err
+		}
+
+		err = checkParents(o.upper(), rel)
+		if err != nil {
+			return err
+		}
+
+		dst := filepath.Join(o.Path, rel)
+		src := filepath.Join(o.upper(), rel)
+		log.Debugf("overlay: %s: %s", change.Kind, dst)
+
+		switch change.Kind {
+		case ChangeDeleted:
+			err = os.RemoveAll(dst)
+		case ChangeAdded, ChangeModified:
+			err = applyFile(src, dst)
+		default:
+			err = errors.Errorf("overlay: invalid change: %s", change.Kind)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func applyFile(src string, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		dstInfo, err := os.Lstat(dst)
+		if err == nil && dstInfo.IsDir() {
+			return os.Chmod(dst, info.Mode().Perm())
+		}
+
+		err = os.RemoveAll(dst)
+		if err != nil {
+			return err
+		}
+		return os.Mkdir(dst, info.Mode().Perm())
+	}
+
+	err = os.RemoveAll(dst)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, dst)
+	case info.Mode().IsRegular():
+		err := iofs.Copy(dst, src)
+		if err != nil {
+			return err
+		}
+		return os.Chmod(dst, info.Mode().Perm())
+	default:
+		return errors.Errorf("overlay: %s: unsupported file type", src)
+	}
+}
+
+// checkParents verifies that the parents of rel in root are directories
+// rather than symlinks.
+func checkParents(root string, rel string) error {
+	path := root
+	for _, name := range strings.Split(filepath.Dir(rel), string(filepath.Separator)) {
+		if name == "." {
+			break
+		}
+
+		path = filepath.Join(path, name)
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return errors.Errorf("overlay: %s: not a directory", path)
+		}
+	}
+	return nil
+}
+
+func lexists(path string) (bool, error) {
+	_, err := os.Lstat(path)
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return false, err
+}
@@ -0,0 +1,33 @@
+package sandbox
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// isWhiteout checks whether info is an overlayfs whiteout, i.e. a character
+// device with device number 0/0 that marks a deleted file.
+func isWhiteout(info os.FileInfo) bool {
+	if info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && stat.Rdev == 0
+}
+
+// isOpaque checks whether the upper directory path hides the content of the
+// lower directory.  Unprivileged overlays use the user namespace for their
+// xattrs.
+func isOpaque(path string) bool {
+	for _, name := range []string{"user.overlay.opaque", "trusted.overlay.opaque"} {
+		buf := make([]byte, 1)
+		n, err := unix.Lgetxattr(path, name, buf)
+		if err == nil && n == 1 && buf[0] == 'y' {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"os"
+)
+
+// isWhiteout returns false because overlayfs is only available on Linux.
+func isWhiteout(_ os.FileInfo) bool {
+	return false
+}
+
+// isOpaque returns false because overlayfs is only available on Linux.
+func isOpaque(_ string) bool {
+	return false
+}
@@ -0,0 +1,166 @@
+//go:build linux
+
+package sandbox_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/illikainen/go-utils/src/iofs"
+	"github.com/illikainen/go-utils/src/sandbox"
+	"github.com/illikainen/go-utils/src/test"
+
+	"golang.org/x/sys/unix"
+)
+
+func writeFile(t *testing.T, path string, data string) {
+	t.Helper()
+
+	err := iofs.WriteFile(path, strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOverlay(t *testing.T) {
+	lower := t.TempDir()
+	dir := t.TempDir()
+
+	writeFile(t, filepath.Join(lower, "modified"), "old")
+	writeFile(t, filepath.Join(lower, "deleted"), "old")
+	writeFile(t, filepath.Join(lower, "unchanged"), "old")
+	writeFile(t, filepath.Join(lower, "opaque", "hidden"), "old")
+
+	o, err := sandbox.NewOverlay(lower, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upper := filepath.Join(dir, "upper")
+	writeFile(t, filepath.Join(upper, "modified"), "new")
+	writeFile(t, filepath.Join(upper, "added", "file"), "new")
+	writeFile(t, filepath.Join(upper, "opaque", "kept"), "new")
+
+	err = unix.Mknod(filepath.Join(upper, "deleted"), unix.S_IFCHR, 0)
+	if err != nil {
+		t.Skipf("whiteouts are unsupported: %v", err)
+	}
+
+	err = unix.Setxattr(filepath.Join(upper, "opaque"), "user.overlay.opaque", []byte("y"), 0)
+	if err != nil {
+		t.Skipf("xattrs are unsupported: %v", err)
+	}
+
+	changes, err := o.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.AssertEq(t, changes, []sandbox.Change{
+		{Kind: sandbox.ChangeAdded, Path: "added"},
+		{Kind: sandbox.ChangeAdded, Path: filepath.Join("added", "file")},
+		{Kind: sandbox.ChangeDeleted, Path: "deleted"},
+		{Kind: sandbox.ChangeModified, Path: "modified"},
+		{Kind: sandbox.ChangeDeleted, Path: filepath.Join("opaque", "hidden")},
+		{Kind: sandbox.ChangeAdded, Path: filepath.Join("opaque", "kept")},
+	})
+
+	err = o.Apply(changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, data := range map[string]string{
+		"modified":                      "new",
+		"unchanged":                     "old",
+		filepath.Join("added", "file"):  "new",
+		filepath.Join("opaque", "kept"): "new",
+	} {
+		buf, err := iofs.ReadFile(filepath.Join(lower, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.AssertEq(t, string(buf), data)
+	}
+
+	for _, path := range []string{"deleted", filepath.Join("opaque", "hidden")} {
+		exists, err := iofs.Exists(filepath.Join(lower, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.AssertEq(t, exists, false)
+	}
+
+	err = o.Apply([]sandbox.Change{{Kind: sandbox.ChangeDeleted, Path: "../x"}})
+	test.AssertNe(t, err, nil)
+}
+
+func TestOverlayApplySymlink(t *testing.T) {
+	lower := t.TempDir()
+	outside := t.TempDir()
+
+	o, err := sandbox.NewOverlay(lower, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upper := filepath.Join(o.Dir, "upper")
+	writeFile(t, filepath.Join(upper, "dir", "file"), "new")
+	err = os.Symlink(outside, filepath.Join(upper, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Symlink(outside, filepath.Join(lower, "dir"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, changes := range [][]sandbox.Change{
+		{{Kind: sandbox.ChangeModified, Path: filepath.Join("dir", "file")}},
+		{
+			{Kind: sandbox.ChangeAdded, Path: "link"},
+			{Kind: sandbox.ChangeAdded, Path: filepath.Join("link", "file")},
+		},
+	} {
+		err = o.Apply(changes)
+		test.AssertNe(t, err, nil)
+
+		exists, err := iofs.Exists(filepath.Join(outside, "file"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.AssertEq(t, exists, false)
+	}
+}
+
+func TestOverlayPlan(t *testing.T) {
+	lower := t.TempDir()
+
+	tmp, err := sandbox.NewOverlay(lower, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = tmp.Diff()
+	test.AssertNe(t, err, nil)
+
+	b, err := sandbox.NewBubblewrap(&sandbox.BubblewrapOptions{Command: []string{"true"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.AddOverlay(tmp)
+
+	plan, err := b.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args := strings.Join(plan.Args, " ")
+	test.AssertEq(t, strings.Contains(args, "--overlay-src "+lower+" --tmp-overlay "+lower), true)
+
+	_, err = sandbox.NewOverlay(filepath.Join(lower, "missing"), "")
+	test.AssertNe(t, err, nil)
+}
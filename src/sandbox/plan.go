@@ -0,0 +1,136 @@
+package sandbox
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	MountReadOnly    = "ro"
+	MountReadOnlyTry = "ro-try"
+	MountReadWrite   = "rw"
+	MountDev         = "dev"
+	MountTmpfs       = "tmpfs"
+	MountDevtmpfs    = "devtmpfs"
+	MountProcfs      = "procfs"
+	MountOverlay     = "overlay"
+	MountTmpOverlay  = "tmp-overlay"
+)
+
+// Mount describes a filesystem that's made available in the sandbox, or a
+// path that was skipped and the reason for it.
+type Mount struct {
+	Type    string `json:"type"`
+	Source  string `json:"source,omitempty"`
+	Target  string `json:"target"`
+	Reason  string `json:"reason"`
+	Skipped bool   `json:"skipped,omitempty"`
+}
+
+// Plan is the computed invocation of bwrap.  It's returned by
+// Bubblewrap.Plan() to inspect a sandbox profile without running it.
+type Plan struct {
+	Args     []string `json:"args"`
+	Env      []string `json:"env"`
+	Mounts   []Mount  `json:"mounts"`
+	Files    []string `json:"files,omitempty"`
+	Seccomp  []string `json:"seccomp,omitempty"`
+	ShareNet bool     `json:"share_net"`
+	Proxy    []string `json:"proxy,omitempty"`
+	UID      int      `json:"uid"`
+	GID      int      `json:"gid"`
+	Groups   []int    `json:"groups,omitempty"`
+	Hostname string   `json:"hostname,omitempty"`
+}
+
+func (p *Plan) addMount(typ string, source string, target string, reason string) {
+	p.Mounts = append(p.Mounts, Mount{Type: typ, Source: source, Target: target, Reason: reason})
+}
+
+func (p *Plan) skipMount(typ string, path string, reason string) {
+	p.Mounts = append(p.Mounts, skippedMount(typ, path, reason))
+}
+
+func skippedMount(typ string, path string, reason string) Mount {
+	return Mount{Type: typ, Source: path, Target: path, Reason: reason, Skipped: true}
+}
+
+// Render writes a human-readable description of the plan.  Only the names of
+// the environment variables are included because their values may be
+// sensitive.
+func (p *Plan) Render(w io.Writer) error {
+	sb := &strings.Builder{}
+
+	sb.WriteString("command:\n")
+	for _, arg := range p.Args {
+		fmt.Fprintf(sb, "  %s\n", arg)
+	}
+
+	sb.WriteString("mounts:\n")
+	tw := tabwriter.NewWriter(sb, 0, 4, 2, ' ', 0)
+	for _, m := range p.Mounts {
+		status := "+"
+		if m.Skipped {
+			status = "-"
+		}
+
+		source := m.Source
+		if source == "" {
+			source = m.Type
+		}
+		fmt.Fprintf(tw, "  %s %s\t%s\t%s\t%s\n", status, m.Type, source, m.Target, m.Reason)
+	}
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	network := "unshared"
+	if p.ShareNet {
+		network = "shared"
+	} else if p.Proxy != nil {
+		network = fmt.Sprintf("proxied to %s", strings.Join(p.Proxy, ", "))
+	}
+	fmt.Fprintf(sb, "network: %s\n", network)
+	fmt.Fprintf(sb, "uid: %d\ngid: %d\n", p.UID, p.GID)
+
+	if len(p.Groups) > 0 {
+		groups := []string{}
+		for _, group := range p.Groups {
+			groups = append(groups, fmt.Sprintf("%d", group))
+		}
+		fmt.Fprintf(sb, "inherited groups: %s\n", strings.Join(groups, ", "))
+	}
+
+	if p.Hostname != "" {
+		fmt.Fprintf(sb, "hostname: %s\n", p.Hostname)
+	}
+
+	if len(p.Files) > 0 {
+		fmt.Fprintf(sb, "files: %s\n", strings.Join(p.Files, ", "))
+	}
+
+	if len(p.Seccomp) > 0 {
+		fmt.Fprintf(sb, "seccomp: %s\n", strings.Join(p.Seccomp, ", "))
+	}
+
+	sb.WriteString("env:\n")
+	for _, env := range p.Env {
+		name, _, _ := strings.Cut(env, "=")
+		fmt.Fprintf(sb, "  %s\n", name)
+	}
+
+	_, err = io.WriteString(w, sb.String())
+	return err
+}
+
+func (p *Plan) String() string {
+	sb := &strings.Builder{}
+	err := p.Render(sb)
+	if err != nil {
+		return err.Error()
+	}
+	return sb.String()
+}
@@ -0,0 +1,92 @@
+package sandbox_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/illikainen/go-utils/src/sandbox"
+	"github.com/illikainen/go-utils/src/seq"
+	"github.com/illikainen/go-utils/src/test"
+)
+
+func TestPlan(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing", "file")
+
+	b, err := sandbox.NewBubblewrap(&sandbox.BubblewrapOptions{
+		Command:        []string{"true"},
+		Env:            []string{"FOO=secret"},
+		ReadOnlyPaths:  []string{missing, dir},
+		ReadWritePaths: []string{missing},
+		Tmpfs:          true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := b.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.AssertEq(t, plan.Args[len(plan.Args)-1], "true")
+	test.AssertEq(t, plan.Env, []string{"FOO=secret", "GO_SANDBOX_ACTIVE=1"})
+	test.AssertEq(t, plan.Mounts, []sandbox.Mount{
+		{Type: sandbox.MountTmpfs, Target: cwd, Reason: "working directory"},
+		{Type: sandbox.MountTmpfs, Target: "/tmp", Reason: "tmpfs enabled"},
+		{
+			Type:   sandbox.MountReadWrite,
+			Source: dir,
+			Target: dir,
+			Reason: "nearest existing parent of " + missing,
+		},
+		{Type: sandbox.MountReadOnly, Source: dir, Target: dir, Reason: "already mounted", Skipped: true},
+		{Type: sandbox.MountReadOnly, Source: missing, Target: missing, Reason: "does not exist", Skipped: true},
+	})
+	test.AssertEq(t, seq.Contains(plan.Args, "--unshare-net"), true)
+
+	out := plan.String()
+	test.AssertEq(t, strings.Contains(out, "secret"), false)
+	test.AssertEq(t, strings.Contains(out, "does not exist"), true)
+}
+
+func TestPlanIdentity(t *testing.T) {
+	uid := 0
+	gid := 65533
+
+	b, err := sandbox.NewBubblewrap(&sandbox.BubblewrapOptions{
+		Command:  []string{"id"},
+		UID:      &uid,
+		GID:      &gid,
+		Hostname: "sandbox",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := b.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.AssertEq(t, plan.UID, 0)
+	test.AssertEq(t, plan.GID, 65533)
+	test.AssertEq(t, plan.Hostname, "sandbox")
+
+	args := strings.Join(plan.Args, " ")
+	test.AssertEq(t, strings.Contains(args, "--uid 0 --gid 65533 --hostname sandbox"), true)
+
+	invalid := -1
+	_, err = sandbox.NewBubblewrap(&sandbox.BubblewrapOptions{UID: &invalid})
+	test.AssertNe(t, err, nil)
+
+	_, err = sandbox.NewBubblewrap(&sandbox.BubblewrapOptions{Hostname: "a/b"})
+	test.AssertNe(t, err, nil)
+}
@@ -0,0 +1,290 @@
+package sandbox
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"strings"
+
+	"github.com/illikainen/go-utils/src/iofs"
+	"github.com/illikainen/go-utils/src/process"
+	"github.com/illikainen/go-utils/src/seq"
+	"github.com/illikainen/go-utils/src/stringx"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Profile is a declarative description of a sandbox.  Paths and command
+// arguments support the placeholders in stringx.Interpolate().  A profile
+// may extend other profiles in the same set.  Lists are concatenated with
+// the lists of the extended profiles, and scalars override them if they're
+// set.  Env is an allowlist of environment variables.  An empty Env removes
+// every variable, while a missing Env keeps the default environment.
+type Profile struct {
+	Extends          []string `json:"extends,omitempty"`
+	ReadOnlyPaths    []string `json:"ro,omitempty"`
+	ReadWritePaths   []string `json:"rw,omitempty"`
+	DevPaths         []string `json:"dev,omitempty"`
+	OverlayPaths     []string `json:"overlay,omitempty"`
+	AllowCommonPaths *bool    `json:"common,omitempty"`
+	Tmpfs            *bool    `json:"tmpfs,omitempty"`
+	Devtmpfs         *bool    `json:"devtmpfs,omitempty"`
+	Procfs           *bool    `json:"procfs,omitempty"`
+	ShareNet         *bool    `json:"net,omitempty"`
+	Proxy            []string `json:"proxy,omitempty"`
+	UID              *int     `json:"uid,omitempty"`
+	GID              *int     `json:"gid,omitempty"`
+	Hostname         string   `json:"hostname,omitempty"`
+	Env              []string `json:"env"`
+	Command          []string `json:"command,omitempty"`
+}
+
+// Profiles is a set of named profiles, as stored in a JSON object.
+type Profiles map[string]*Profile
+
+func LoadProfiles(path string) (Profiles, error) {
+	data, err := iofs.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles, err := ParseProfiles(data)
+	if err != nil {
+		return nil, errors.Wrap(err, path)
+	}
+	return profiles, nil
+}
+
+func ParseProfiles(data []byte) (Profiles, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	profiles := Profiles{}
+	err := decoder.Decode(&profiles)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, profile := range profiles {
+		if profile == nil {
+			return nil, errors.Errorf("profile %s is empty", name)
+		}
+	}
+
+	return profiles, nil
+}
+
+// Resolve returns the named profile with its ancestors merged and with
+// interpolated and validated paths.
+func (p Profiles) Resolve(name string) (*Profile, error) {
+	profile, err := p.merge(name, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	profile.Extends = nil
+
+	for _, paths := range []*[]string{
+		&profile.ReadOnlyPaths,
+		&profile.ReadWritePaths,
+		&profile.DevPaths,
+		&profile.OverlayPaths,
+		&profile.Command,
+	} {
+		for i, value := range *paths {
+			(*paths)[i], err = stringx.Interpolate(value)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	err = profile.Validate()
+	if err != nil {
+		return nil, errors.Wrapf(err, "profile %s", name)
+	}
+
+	return profile, nil
+}
+
+func (p Profiles) merge(name string, visited []string) (*Profile, error) {
+	if seq.Contains(visited, name) {
+		return nil, errors.Errorf("profile %s: circular inheritance: %s", name, strings.Join(visited, " -> "))
+	}
+	visited = append(visited, name)
+
+	profile, ok := p[name]
+	if !ok {
+		return nil, errors.Errorf("profile %s does not exist", name)
+	}
+
+	result := &Profile{}
+	for _, parent := range profile.Extends {
+		merged, err := p.merge(parent, visited)
+		if err != nil {
+			return nil, err
+		}
+		result.inherit(merged)
+	}
+	result.inherit(profile)
+
+	return result, nil
+}
+
+func (p *Profile) inherit(other *Profile) {
+	p.ReadOnlyPaths = append(p.ReadOnlyPaths, other.ReadOnlyPaths...)
+	p.ReadWritePaths = append(p.ReadWritePaths, other.ReadWritePaths...)
+	p.DevPaths = append(p.DevPaths, other.DevPaths...)
+	p.OverlayPaths = append(p.OverlayPaths, other.OverlayPaths...)
+	p.Proxy = seq.Uniq(append(p.Proxy, other.Proxy...))
+	if other.Env != nil {
+		env := seq.Uniq(append(p.Env, other.Env...))
+		if env == nil {
+			env = []string{}
+		}
+		p.Env = env
+	}
+
+	for _, value := range []struct {
+		dst **bool
+		src *bool
+	}{
+		{&p.AllowCommonPaths, other.AllowCommonPaths},
+		{&p.Tmpfs, other.Tmpfs},
+		{&p.Devtmpfs, other.Devtmpfs},
+		{&p.Procfs, other.Procfs},
+		{&p.ShareNet, other.ShareNet},
+	} {
+		if value.src != nil {
+			v := *value.src
+			*value.dst = &v
+		}
+	}
+
+	for _, value := range []struct {
+		dst **int
+		src *int
+	}{
+		{&p.UID, other.UID},
+		{&p.GID, other.GID},
+	} {
+		if value.src != nil {
+			v := *value.src
+			*value.dst = &v
+		}
+	}
+
+	if other.Hostname != "" {
+		p.Hostname = other.Hostname
+	}
+
+	if len(other.Command) > 0 {
+		p.Command = append([]string{}, other.Command...)
+	}
+}
+
+// Validate checks the paths of the profile against the same rules that are
+// enforced when paths are added to a sandbox.
+func (p *Profile) Validate() error {
+	for _, paths := range [][]string{p.ReadOnlyPaths, p.ReadWritePaths, p.DevPaths, p.OverlayPaths} {
+		for _, path := range paths {
+			_, err := expand(path)
+			if err != nil {
+				return errors.Wrap(err, path)
+			}
+		}
+	}
+
+	for _, address := range p.Proxy {
+		_, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	for _, name := range p.Env {
+		if name == "" || strings.Contains(name, "=") {
+			return errors.Errorf("invalid environment variable: %s", name)
+		}
+	}
+
+	return nil
+}
+
+// Sandbox creates a sandbox for the backend from the profile.  Settings that
+// aren't supported by the backend are ignored.
+func (p *Profile) Sandbox(backend int) (Sandbox, error) {
+	switch backend {
+	case BubblewrapSandbox:
+		b, err := NewBubblewrap(&BubblewrapOptions{
+			Command:          p.Command,
+			EnvPolicy:        p.envPolicy(),
+			ReadOnlyPaths:    p.ReadOnlyPaths,
+			ReadWritePaths:   p.ReadWritePaths,
+			DevPaths:         p.DevPaths,
+			OverlayPaths:     p.OverlayPaths,
+			AllowCommonPaths: isTrue(p.AllowCommonPaths),
+			Tmpfs:            isTrue(p.Tmpfs),
+			Devtmpfs:         isTrue(p.Devtmpfs),
+			Procfs:           isTrue(p.Procfs),
+			ShareNet:         isTrue(p.ShareNet),
+			Network:          p.network(),
+			UID:              p.UID,
+			GID:              p.GID,
+			Hostname:         p.Hostname,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return b, nil
+	case LandlockSandbox:
+		if len(p.Command) > 0 || p.Env != nil || p.UID != nil || p.GID != nil || p.Hostname != "" ||
+			len(p.OverlayPaths) > 0 || len(p.Proxy) > 0 {
+			log.Debug("landlock: command, env, ids, hostname, overlays and proxy are ignored in profiles")
+		}
+
+		l, err := NewLandlock(&LandlockOptions{
+			ReadOnlyPaths:    p.ReadOnlyPaths,
+			ReadWritePaths:   p.ReadWritePaths,
+			DevPaths:         p.DevPaths,
+			AllowCommonPaths: isTrue(p.AllowCommonPaths),
+			ShareNet:         isTrue(p.ShareNet),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return l, nil
+	case NoSandbox:
+		return NewNoop()
+	default:
+		return nil, errors.Errorf("invalid sandbox backend: %d", backend)
+	}
+}
+
+// envPolicy returns a policy that only keeps the variables in the allowlist,
+// or nil for the default policy if there's no allowlist.  An empty Allow
+// keeps every variable in an EnvPolicy, so an empty allowlist is expressed
+// with Deny instead.
+func (p *Profile) envPolicy() *process.EnvPolicy {
+	if p.Env == nil {
+		return nil
+	}
+	if len(p.Env) == 0 {
+		return &process.EnvPolicy{Deny: []string{"*"}}
+	}
+	return &process.EnvPolicy{Allow: p.Env}
+}
+
+// network returns a proxy for the allowlist, or nil if there's no
+// allowlist.
+func (p *Profile) network() *NetworkProxy {
+	if len(p.Proxy) == 0 {
+		return nil
+	}
+	return &NetworkProxy{Allow: p.Proxy}
+}
+
+func isTrue(value *bool) bool {
+	return value != nil && *value
+}
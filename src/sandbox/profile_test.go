@@ -0,0 +1,93 @@
+package sandbox_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/illikainen/go-utils/src/sandbox"
+	"github.com/illikainen/go-utils/src/test"
+)
+
+func TestProfiles(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profiles, err := sandbox.ParseProfiles([]byte(`{
+		"base": {"ro": ["/usr"], "common": true, "net": true, "env": ["PATH"], "uid": 0},
+		"tool": {
+			"extends": ["base"],
+			"rw": ["{home}/.cache/tool"],
+			"net": false,
+			"env": ["PATH", "LANG"],
+			"command": ["tool", "--flag"]
+		},
+		"home": {"ro": ["{home}"]},
+		"loop1": {"extends": ["loop2"]},
+		"loop2": {"extends": ["loop1"]}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err := profiles.Resolve("tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.AssertEq(t, profile.ReadOnlyPaths, []string{"/usr"})
+	test.AssertEq(t, profile.ReadWritePaths, []string{filepath.Join(home, ".cache", "tool")})
+	test.AssertEq(t, *profile.AllowCommonPaths, true)
+	test.AssertEq(t, *profile.ShareNet, false)
+	test.AssertEq(t, profile.Env, []string{"PATH", "LANG"})
+	test.AssertEq(t, profile.Command, []string{"tool", "--flag"})
+	test.AssertEq(t, *profile.UID, 0)
+	test.AssertEq(t, profile.GID, (*int)(nil))
+
+	_, err = profiles.Resolve("home")
+	test.AssertNe(t, err, nil)
+
+	_, err = profiles.Resolve("loop1")
+	test.AssertNe(t, err, nil)
+
+	_, err = profiles.Resolve("missing")
+	test.AssertNe(t, err, nil)
+
+	sb, err := profile.Sandbox(sandbox.NoSandbox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertNe(t, sb, nil)
+}
+
+func TestProfilesUnknownField(t *testing.T) {
+	_, err := sandbox.ParseProfiles([]byte(`{"foo": {"readonly": ["/usr"]}}`))
+	test.AssertNe(t, err, nil)
+}
+
+func TestProfilesEmptyEnv(t *testing.T) {
+	profiles, err := sandbox.ParseProfiles([]byte(`{
+		"default": {"ro": ["/usr"]},
+		"empty": {"env": []},
+		"child": {"extends": ["empty"], "ro": ["/usr"]},
+		"override": {"extends": ["empty"], "env": ["PATH"]}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, env := range map[string][]string{
+		"default":  nil,
+		"empty":    {},
+		"child":    {},
+		"override": {"PATH"},
+	} {
+		profile, err := profiles.Resolve(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.AssertEq(t, profile.Env, env)
+	}
+}
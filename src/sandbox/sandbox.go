@@ -4,12 +4,14 @@ import (
 	"io"
 	"os"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/illikainen/go-utils/src/iofs"
 	"github.com/illikainen/go-utils/src/logging"
 	"github.com/illikainen/go-utils/src/process"
+	"github.com/illikainen/go-utils/src/rpc"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -18,6 +20,7 @@ import (
 const (
 	BubblewrapSandbox = 1 << iota
 	NoSandbox
+	LandlockSandbox
 )
 
 type Sandbox interface {
@@ -34,6 +37,7 @@ type Sandbox interface {
 const disableEnv = "GO_SANDBOX_DISABLE"
 const activeEnv = "GO_SANDBOX_ACTIVE"
 const debugEnv = "GO_SANDBOX_DEBUG"
+const rpcEnv = "GO_SANDBOX_RPC"
 
 func init() {
 	if Compatible() && IsSandboxed() {
@@ -53,6 +57,8 @@ func Backend(name string) (int, error) {
 	switch strings.ToLower(name) {
 	case "bubblewrap":
 		return BubblewrapSandbox, nil
+	case "landlock":
+		return LandlockSandbox, nil
 	case "none":
 		return NoSandbox, nil
 	case "":
@@ -64,6 +70,13 @@ func Backend(name string) (int, error) {
 		return BubblewrapSandbox, nil
 	}
 
+	// Landlock doesn't depend on user namespaces, so it's used as a
+	// fallback in containers where bubblewrap can't run.
+	if runtime.GOOS == "linux" && LandlockABI() > 0 {
+		log.Debugf("sandbox: using landlock (ABI v%d)", LandlockABI())
+		return LandlockSandbox, nil
+	}
+
 	log.Warnf("sandbox not compatible with %s", runtime.GOOS)
 	log.Warnf("configure `sandbox = none` to disable this warning")
 	return NoSandbox, nil
@@ -73,6 +86,35 @@ func IsSandboxed() bool {
 	return os.Getenv(activeEnv) == "1"
 }
 
+// RPC connects to the parent of a sandboxed process if it was confined with
+// BubblewrapOptions.RPC.  Requests from the parent are dispatched to mux,
+// which may be nil.
+func RPC(mux *rpc.Mux) (*rpc.Conn, error) {
+	value := os.Getenv(rpcEnv)
+	if !IsSandboxed() || value == "" {
+		return nil, errors.Errorf("rpc is not available")
+	}
+
+	fd, err := strconv.Atoi(value)
+	if err != nil || fd < 3 {
+		return nil, errors.Errorf("invalid %s: %s", rpcEnv, value)
+	}
+
+	conn, err := rpc.FileConn(os.NewFile(uintptr(fd), "rpc"), mux)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		err := conn.Serve()
+		if err != nil {
+			log.Debugf("rpc: %v", err)
+		}
+	}()
+
+	return conn, nil
+}
+
 func AwaitDebugger() {
 	log.Info("waiting for debugger to change `attached`...")
 
@@ -0,0 +1,184 @@
+package sandbox
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/illikainen/go-utils/src/bpf"
+	"github.com/illikainen/go-utils/src/errorx"
+	"github.com/illikainen/go-utils/src/seq"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultSeccompDeny is the list of syscalls that are denied by a
+// SeccompPolicy unless they're explicitly allowed.  It covers debugging of
+// other processes, kernel keyrings, eBPF, module loading, mount APIs,
+// namespaces, clock adjustments and other syscalls that a confined process
+// shouldn't need.
+var DefaultSeccompDeny = []string{
+	"acct",
+	"add_key",
+	"adjtimex",
+	"bpf",
+	"clock_adjtime",
+	"clock_settime",
+	"delete_module",
+	"fanotify_init",
+	"finit_module",
+	"fsconfig",
+	"fsmount",
+	"fsopen",
+	"fspick",
+	"init_module",
+	"io_uring_enter",
+	"io_uring_register",
+	"io_uring_setup",
+	"kcmp",
+	"kexec_load",
+	"keyctl",
+	"lookup_dcookie",
+	"mount",
+	"mount_setattr",
+	"move_mount",
+	"name_to_handle_at",
+	"nfsservctl",
+	"open_by_handle_at",
+	"open_tree",
+	"perf_event_open",
+	"pidfd_getfd",
+	"pivot_root",
+	"process_vm_readv",
+	"process_vm_writev",
+	"ptrace",
+	"quotactl",
+	"reboot",
+	"request_key",
+	"setdomainname",
+	"sethostname",
+	"setns",
+	"settimeofday",
+	"swapoff",
+	"swapon",
+	"syslog",
+	"umount2",
+	"unshare",
+	"userfaultfd",
+	"vhangup",
+}
+
+// Offsets into `struct seccomp_data`.
+const (
+	seccompDataNr   = 0
+	seccompDataArch = 4
+)
+
+// Constants from <linux/seccomp.h> and <linux/audit.h>.  They're duplicated
+// here to keep the policy compiler usable (and testable) on every platform.
+const (
+	seccompRetKillProcess = 0x80000000
+	seccompRetErrno       = 0x00050000
+	seccompRetAllow       = 0x7fff0000
+	seccompErrnoEPERM     = 1
+	auditArchX8664        = 0xc000003e
+	x32SyscallBit         = 0x40000000
+)
+
+// SeccompPolicy describes the syscalls that are denied in a sandbox.  The
+// denied syscalls are DefaultSeccompDeny and Deny, minus Allow.  Denied
+// syscalls fail with EPERM and syscalls for a foreign architecture kill the
+// process.
+type SeccompPolicy struct {
+	Allow []string
+	Deny  []string
+}
+
+func (p *SeccompPolicy) Syscalls() []string {
+	names := append(append([]string{}, DefaultSeccompDeny...), p.Deny...)
+	names = seq.Filter(seq.Uniq(names), p.Allow...)
+	sort.Strings(names)
+	return names
+}
+
+// MaxSeccompDeny is the largest number of syscalls that can be denied by a
+// SeccompPolicy.  Each denied syscall takes two instructions, and the whole
+// program must fit in bpf.MaxInstructions.
+const MaxSeccompDeny = (bpf.MaxInstructions - seccompFixedInstructions) / 2
+
+// seccompFixedInstructions is the number of instructions in a compiled
+// policy that don't depend on the denied syscalls.
+const seccompFixedInstructions = 7
+
+func (p *SeccompPolicy) Compile() ([]bpf.Instruction, error) {
+	arch, err := auditArch()
+	if err != nil {
+		return nil, err
+	}
+
+	names := p.Syscalls()
+	if len(names) > MaxSeccompDeny {
+		return nil, errors.Errorf("seccomp: too many denied syscalls: %d (max %d)", len(names), MaxSeccompDeny)
+	}
+
+	// Conditional jumps can only skip 255 instructions, so every check
+	// returns on its own instead of jumping to a shared return.
+	deny := uint32(seccompRetErrno | seccompErrnoEPERM)
+
+	asm := bpf.NewAssembler()
+	asm.LoadAbs(seccompDataArch)
+	asm.JumpIf(bpf.JEQ, arch, "native", "")
+	asm.Ret(seccompRetKillProcess)
+	asm.Label("native").LoadAbs(seccompDataNr)
+	if arch == auditArchX8664 {
+		// Syscalls with __X32_SYSCALL_BIT set use the x32 ABI on
+		// x86-64.  They have different numbers that'd bypass the
+		// filter below.
+		asm.JumpIf(bpf.JGE, x32SyscallBit, "", "x64")
+		asm.Ret(deny)
+		asm.Label("x64")
+	}
+
+	for i, name := range names {
+		nr, ok := syscallNumbers[name]
+		if !ok {
+			return nil, errors.Errorf("seccomp: unknown syscall: %s", name)
+		}
+
+		next := fmt.Sprintf("next%d", i)
+		asm.JumpIf(bpf.JEQ, nr, "", next)
+		asm.Ret(deny)
+		asm.Label(next)
+	}
+
+	asm.Ret(seccompRetAllow)
+	return asm.Assemble()
+}
+
+// File returns an unlinked file with the compiled policy.  It's meant to be
+// inherited by bwrap with `--seccomp`.
+func (p *SeccompPolicy) File() (*os.File, error) {
+	prog, err := p.Compile()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.CreateTemp("", "seccomp-")
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Remove(f.Name())
+	if err == nil {
+		_, err = f.Write(bpf.Marshal(prog, bpf.NativeEndian))
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return nil, errorx.Join(err, f.Close())
+	}
+
+	return f, nil
+}
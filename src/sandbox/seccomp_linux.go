@@ -0,0 +1,101 @@
+package sandbox
+
+import (
+	"runtime"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// syscallNumbers maps the syscalls that may be referenced by a SeccompPolicy
+// to their numbers on the current architecture.  Only syscalls that exist on
+// every Linux architecture are included.
+var syscallNumbers = map[string]uint32{
+	"accept4":                 unix.SYS_ACCEPT4,
+	"acct":                    unix.SYS_ACCT,
+	"add_key":                 unix.SYS_ADD_KEY,
+	"adjtimex":                unix.SYS_ADJTIMEX,
+	"bind":                    unix.SYS_BIND,
+	"bpf":                     unix.SYS_BPF,
+	"chroot":                  unix.SYS_CHROOT,
+	"clock_adjtime":           unix.SYS_CLOCK_ADJTIME,
+	"clock_settime":           unix.SYS_CLOCK_SETTIME,
+	"connect":                 unix.SYS_CONNECT,
+	"delete_module":           unix.SYS_DELETE_MODULE,
+	"execve":                  unix.SYS_EXECVE,
+	"execveat":                unix.SYS_EXECVEAT,
+	"fanotify_init":           unix.SYS_FANOTIFY_INIT,
+	"finit_module":            unix.SYS_FINIT_MODULE,
+	"fsconfig":                unix.SYS_FSCONFIG,
+	"fsmount":                 unix.SYS_FSMOUNT,
+	"fsopen":                  unix.SYS_FSOPEN,
+	"fspick":                  unix.SYS_FSPICK,
+	"init_module":             unix.SYS_INIT_MODULE,
+	"io_uring_enter":          unix.SYS_IO_URING_ENTER,
+	"io_uring_register":       unix.SYS_IO_URING_REGISTER,
+	"io_uring_setup":          unix.SYS_IO_URING_SETUP,
+	"kcmp":                    unix.SYS_KCMP,
+	"kexec_load":              unix.SYS_KEXEC_LOAD,
+	"keyctl":                  unix.SYS_KEYCTL,
+	"landlock_add_rule":       unix.SYS_LANDLOCK_ADD_RULE,
+	"landlock_create_ruleset": unix.SYS_LANDLOCK_CREATE_RULESET,
+	"landlock_restrict_self":  unix.SYS_LANDLOCK_RESTRICT_SELF,
+	"listen":                  unix.SYS_LISTEN,
+	"lookup_dcookie":          unix.SYS_LOOKUP_DCOOKIE,
+	"memfd_create":            unix.SYS_MEMFD_CREATE,
+	"mknodat":                 unix.SYS_MKNODAT,
+	"mount":                   unix.SYS_MOUNT,
+	"mount_setattr":           unix.SYS_MOUNT_SETATTR,
+	"move_mount":              unix.SYS_MOVE_MOUNT,
+	"name_to_handle_at":       unix.SYS_NAME_TO_HANDLE_AT,
+	"nfsservctl":              unix.SYS_NFSSERVCTL,
+	"open_by_handle_at":       unix.SYS_OPEN_BY_HANDLE_AT,
+	"open_tree":               unix.SYS_OPEN_TREE,
+	"perf_event_open":         unix.SYS_PERF_EVENT_OPEN,
+	"personality":             unix.SYS_PERSONALITY,
+	"pidfd_getfd":             unix.SYS_PIDFD_GETFD,
+	"pivot_root":              unix.SYS_PIVOT_ROOT,
+	"process_vm_readv":        unix.SYS_PROCESS_VM_READV,
+	"process_vm_writev":       unix.SYS_PROCESS_VM_WRITEV,
+	"ptrace":                  unix.SYS_PTRACE,
+	"quotactl":                unix.SYS_QUOTACTL,
+	"reboot":                  unix.SYS_REBOOT,
+	"request_key":             unix.SYS_REQUEST_KEY,
+	"seccomp":                 unix.SYS_SECCOMP,
+	"setdomainname":           unix.SYS_SETDOMAINNAME,
+	"sethostname":             unix.SYS_SETHOSTNAME,
+	"setns":                   unix.SYS_SETNS,
+	"settimeofday":            unix.SYS_SETTIMEOFDAY,
+	"socket":                  unix.SYS_SOCKET,
+	"socketpair":              unix.SYS_SOCKETPAIR,
+	"swapoff":                 unix.SYS_SWAPOFF,
+	"swapon":                  unix.SYS_SWAPON,
+	"syslog":                  unix.SYS_SYSLOG,
+	"umount2":                 unix.SYS_UMOUNT2,
+	"unshare":                 unix.SYS_UNSHARE,
+	"userfaultfd":             unix.SYS_USERFAULTFD,
+	"vhangup":                 unix.SYS_VHANGUP,
+}
+
+func auditArch() (uint32, error) {
+	switch runtime.GOARCH {
+	case "386":
+		return unix.AUDIT_ARCH_I386, nil
+	case "amd64":
+		return unix.AUDIT_ARCH_X86_64, nil
+	case "arm":
+		return unix.AUDIT_ARCH_ARM, nil
+	case "arm64":
+		return unix.AUDIT_ARCH_AARCH64, nil
+	case "ppc64":
+		return unix.AUDIT_ARCH_PPC64, nil
+	case "ppc64le":
+		return unix.AUDIT_ARCH_PPC64LE, nil
+	case "riscv64":
+		return unix.AUDIT_ARCH_RISCV64, nil
+	case "s390x":
+		return unix.AUDIT_ARCH_S390X, nil
+	default:
+		return 0, errors.Errorf("seccomp: %s is not supported", runtime.GOARCH)
+	}
+}
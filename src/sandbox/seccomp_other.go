@@ -0,0 +1,15 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+var syscallNumbers = map[string]uint32{}
+
+func auditArch() (uint32, error) {
+	return 0, errors.Errorf("seccomp: %s is not supported", runtime.GOOS)
+}
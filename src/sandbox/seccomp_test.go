@@ -0,0 +1,87 @@
+//go:build linux
+
+package sandbox_test
+
+import (
+	"testing"
+
+	"github.com/illikainen/go-utils/src/bpf"
+	"github.com/illikainen/go-utils/src/sandbox"
+	"github.com/illikainen/go-utils/src/seq"
+	"github.com/illikainen/go-utils/src/test"
+
+	"golang.org/x/sys/unix"
+)
+
+func seccompData(arch uint32, nr uint32) []byte {
+	data := make([]byte, 64)
+	bpf.NativeEndian.PutUint32(data[0:], nr)
+	bpf.NativeEndian.PutUint32(data[4:], arch)
+	return data
+}
+
+func TestSeccompPolicy(t *testing.T) {
+	policy := &sandbox.SeccompPolicy{
+		Allow: []string{"ptrace"},
+		Deny:  []string{"socket"},
+	}
+
+	syscalls := policy.Syscalls()
+	test.AssertEq(t, seq.Contains(syscalls, "ptrace"), false)
+	test.AssertEq(t, seq.Contains(syscalls, "socket"), true)
+	test.AssertEq(t, seq.Contains(syscalls, "bpf"), true)
+
+	prog, err := policy.Compile()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	ret, err := bpf.Run(prog, seccompData(0, unix.SYS_GETPID), bpf.NativeEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, ret, uint32(unix.SECCOMP_RET_KILL_PROCESS))
+
+	native := uint32(0)
+	for _, cur := range []uint32{
+		unix.AUDIT_ARCH_X86_64, unix.AUDIT_ARCH_AARCH64, unix.AUDIT_ARCH_I386, unix.AUDIT_ARCH_ARM,
+		unix.AUDIT_ARCH_PPC64, unix.AUDIT_ARCH_PPC64LE, unix.AUDIT_ARCH_RISCV64, unix.AUDIT_ARCH_S390X,
+	} {
+		ret, err := bpf.Run(prog, seccompData(cur, unix.SYS_GETPID), bpf.NativeEndian)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ret == unix.SECCOMP_RET_ALLOW {
+			native = cur
+		}
+	}
+	test.AssertNe(t, native, uint32(0))
+
+	for nr, expected := range map[uint32]uint32{
+		unix.SYS_GETPID: unix.SECCOMP_RET_ALLOW,
+		unix.SYS_PTRACE: unix.SECCOMP_RET_ALLOW,
+		unix.SYS_SOCKET: unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM),
+		unix.SYS_BPF:    unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM),
+		unix.SYS_MOUNT:  unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM),
+	} {
+		ret, err := bpf.Run(prog, seccompData(native, nr), bpf.NativeEndian)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.AssertEq(t, ret, expected)
+	}
+
+	if native == unix.AUDIT_ARCH_X86_64 {
+		ret, err := bpf.Run(prog, seccompData(native, 0x40000000|unix.SYS_GETPID), bpf.NativeEndian)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.AssertEq(t, ret, unix.SECCOMP_RET_ERRNO|uint32(unix.EPERM))
+	}
+}
+
+func TestSeccompPolicyUnknownSyscall(t *testing.T) {
+	policy := &sandbox.SeccompPolicy{Deny: []string{"does_not_exist"}}
+	_, err := policy.Compile()
+	test.AssertNe(t, err, nil)
+}
@@ -0,0 +1,236 @@
+package stringx
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Modes for ANSI escape sequences.  Only CSI sequences (e.g. colors and
+// cursor movement) and OSC sequences (e.g. window titles and hyperlinks) are
+// recognized.  Other escape sequences are treated like any other control
+// character.
+const (
+	// SequenceReplace treats the ESC character like any other control
+	// character.
+	SequenceReplace = iota
+
+	// SequenceStrip removes the sequences.
+	SequenceStrip
+
+	// SequenceEscape makes the sequences visible by escaping their control
+	// characters, e.g. as \x1b[1m.
+	SequenceEscape
+
+	// SequenceColor keeps SGR sequences, i.e. colors and text attributes,
+	// and removes other sequences.
+	SequenceColor
+)
+
+// MaxSequenceLength is the longest escape sequence that's recognized.
+const MaxSequenceLength = 4096
+
+const replacement = '_'
+
+var ErrInvalidCharacter = errors.New("invalid character")
+
+// Policy decides which characters are allowed by Sanitize().  Newlines and
+// printable ASCII characters are always allowed.  Other characters are
+// replaced with an underscore, or rejected with an error if Reject is set.
+//
+// The zero Policy is the same as the behavior of the package-level
+// Sanitize().
+type Policy struct {
+	// UTF8 allows printable non-ASCII runes.
+	UTF8 bool
+
+	// Tab allows horizontal tabs.
+	Tab bool
+
+	// Sequences is the mode for ANSI escape sequences.
+	Sequences int
+
+	// RejectBidi rejects bidirectional override and isolate characters
+	// that can be used to disguise the order of text, even if Reject isn't
+	// set.
+	RejectBidi bool
+
+	// Reject fails on characters that aren't allowed instead of replacing
+	// them.
+	Reject bool
+}
+
+// DefaultPolicy replaces everything except newlines and printable ASCII.
+var DefaultPolicy = &Policy{}
+
+// StrictPolicy rejects everything except newlines and printable ASCII.  It
+// can be passed to the output functions in the process package to fail on
+// unexpected output from children.
+var StrictPolicy = &Policy{Reject: true}
+
+// Sanitize returns a sanitized copy of s.  The error wraps
+// ErrInvalidCharacter and includes the offset of the character.
+func (p *Policy) Sanitize(s []byte) ([]byte, error) {
+	out, _, err := p.sanitize(s, true)
+	return out, err
+}
+
+func (p *Policy) SanitizeString(s string) (string, error) {
+	out, _, err := p.sanitize([]byte(s), true)
+	return string(out), err
+}
+
+// SanitizePartial is like Sanitize, but an incomplete rune or escape
+// sequence at the end of s is left for the next call.  It returns the number
+// of consumed bytes.  It's meant for data that's read in chunks.
+func (p *Policy) SanitizePartial(s []byte) ([]byte, int, error) {
+	return p.sanitize(s, false)
+}
+
+func (p *Policy) sanitize(s []byte, final bool) ([]byte, int, error) {
+	out := make([]byte, 0, len(s))
+
+	i := 0
+	for i < len(s) {
+		if s[i] == 0x1b && p.Sequences != SequenceReplace {
+			n, incomplete := sequenceLength(s[i:])
+			if incomplete && !final && len(s)-i < MaxSequenceLength {
+				break
+			}
+
+			if n > 0 {
+				out = p.appendSequence(out, s[i:i+n])
+				i += n
+				continue
+			}
+		}
+
+		if !final && !utf8.FullRune(s[i:]) {
+			break
+		}
+
+		r, size := utf8.DecodeRune(s[i:])
+		if p.allowed(r, size) {
+			out = append(out, s[i:i+size]...)
+			i += size
+			continue
+		}
+
+		if (p.RejectBidi && isBidi(r)) || p.Reject {
+			return nil, i, errors.Wrapf(ErrInvalidCharacter, "%U at offset %d", r, i)
+		}
+
+		// Without UTF-8, every byte is replaced to retain the behavior of
+		// the package-level Sanitize().
+		if !p.UTF8 {
+			size = 1
+		}
+		out = append(out, replacement)
+		i += size
+	}
+
+	return out, i, nil
+}
+
+func (p *Policy) allowed(r rune, size int) bool {
+	switch {
+	case r == '\n':
+		return true
+	case r == '\t':
+		return p.Tab
+	case r >= 0x20 && r <= 0x7e:
+		return true
+	case r == utf8.RuneError && size <= 1:
+		return false
+	case r < utf8.RuneSelf:
+		return false
+	default:
+		return p.UTF8 && unicode.IsPrint(r) && !isBidi(r)
+	}
+}
+
+func (p *Policy) appendSequence(out []byte, seq []byte) []byte {
+	switch p.Sequences {
+	case SequenceEscape:
+		for _, b := range seq {
+			if b >= 0x20 && b <= 0x7e {
+				out = append(out, b)
+			} else {
+				out = append(out, fmt.Sprintf("\\x%02x", b)...)
+			}
+		}
+	case SequenceColor:
+		if isSGR(seq) {
+			out = append(out, seq...)
+		}
+	}
+	return out
+}
+
+// sequenceLength returns the length of the CSI or OSC sequence at the start
+// of s, or 0 if there isn't a valid sequence.  incomplete is true if s is a
+// valid prefix of a sequence.
+func sequenceLength(s []byte) (int, bool) {
+	if len(s) < 2 {
+		return 0, true
+	}
+
+	switch s[1] {
+	case '[':
+		i := 2
+		for i < len(s) && s[i] >= 0x30 && s[i] <= 0x3f {
+			i++
+		}
+		for i < len(s) && s[i] >= 0x20 && s[i] <= 0x2f {
+			i++
+		}
+		if i == len(s) {
+			return 0, true
+		}
+		if s[i] >= 0x40 && s[i] <= 0x7e {
+			return i + 1, false
+		}
+	case ']':
+		for i := 2; i < len(s); i++ {
+			switch {
+			case s[i] == 0x07:
+				return i + 1, false
+			case s[i] == 0x1b:
+				if i+1 == len(s) {
+					return 0, true
+				}
+				if s[i+1] == '\\' {
+					return i + 2, false
+				}
+				return 0, false
+			case s[i] < 0x20 || s[i] == 0x7f:
+				return 0, false
+			}
+		}
+		return 0, true
+	}
+
+	return 0, false
+}
+
+// isSGR checks whether seq is a CSI sequence that only sets text
+// attributes.
+func isSGR(seq []byte) bool {
+	if len(seq) < 3 || seq[1] != '[' || seq[len(seq)-1] != 'm' {
+		return false
+	}
+
+	for _, b := range seq[2 : len(seq)-1] {
+		if (b < '0' || b > '9') && b != ';' && b != ':' {
+			return false
+		}
+	}
+	return true
+}
+
+func isBidi(r rune) bool {
+	return (r >= 0x202a && r <= 0x202e) || (r >= 0x2066 && r <= 0x2069) ||
+		r == 0x200e || r == 0x200f || r == 0x061c
+}
@@ -0,0 +1,84 @@
+package stringx_test
+
+import (
+	"testing"
+
+	"github.com/illikainen/go-utils/src/stringx"
+	"github.com/illikainen/go-utils/src/test"
+
+	"github.com/pkg/errors"
+)
+
+func TestSanitize(t *testing.T) {
+	input := []byte("a\tb\x00\u00e9\n")
+	test.AssertEq(t, string(stringx.Sanitize(input)), "a_b___\n")
+	test.AssertEq(t, string(input), "a\tb\x00\u00e9\n")
+	test.AssertEq(t, stringx.Sanitize("\x1b[1m"), "_[1m")
+}
+
+func TestPolicyUTF8(t *testing.T) {
+	policy := &stringx.Policy{UTF8: true, Tab: true}
+
+	out, err := policy.SanitizeString("a\tb \u00e9\u65e5\x00\xff\u202e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, out, "a\tb \u00e9\u65e5___")
+
+	policy.RejectBidi = true
+	_, err = policy.SanitizeString("abc\u202edef")
+	test.AssertEq(t, errors.Is(err, stringx.ErrInvalidCharacter), true)
+
+	_, err = stringx.StrictPolicy.SanitizeString("abc\x01")
+	test.AssertEq(t, errors.Is(err, stringx.ErrInvalidCharacter), true)
+}
+
+func TestPolicySequences(t *testing.T) {
+	input := "\x1b[1mbold\x1b[0m \x1b[2J\x1b]0;title\x07 \x1b]8;;https://example.com\x1b\\link\x1b]8;;\x1b\\"
+
+	for mode, expected := range map[int]string{
+		stringx.SequenceReplace: "_[1mbold_[0m _[2J_]0;title_ _]8;;https://example.com_\\link_]8;;_\\",
+		stringx.SequenceStrip:   "bold  link",
+		stringx.SequenceEscape: "\\x1b[1mbold\\x1b[0m \\x1b[2J\\x1b]0;title\\x07 " +
+			"\\x1b]8;;https://example.com\\x1b\\link\\x1b]8;;\\x1b\\",
+		stringx.SequenceColor: "\x1b[1mbold\x1b[0m  link",
+	} {
+		policy := &stringx.Policy{Sequences: mode}
+		out, err := policy.SanitizeString(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.AssertEq(t, out, expected)
+	}
+
+	policy := &stringx.Policy{Sequences: stringx.SequenceStrip}
+	out, err := policy.SanitizeString("\x1b]0;unterminated\nfoo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, out, "_]0;unterminated\nfoo")
+}
+
+func TestPolicyPartial(t *testing.T) {
+	policy := &stringx.Policy{UTF8: true, Sequences: stringx.SequenceStrip}
+
+	out, n, err := policy.SanitizePartial([]byte("ab\x1b[1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, string(out), "ab")
+	test.AssertEq(t, n, 2)
+
+	out, n, err = policy.SanitizePartial([]byte("a\xc3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, string(out), "a")
+	test.AssertEq(t, n, 1)
+
+	out, err = policy.Sanitize([]byte("a\xc3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEq(t, string(out), "a_")
+}
@@ -26,22 +26,14 @@ func Interpolate(s string) (string, error) {
 	return repl.Replace(s), nil
 }
 
+// Sanitize returns a copy of s where everything except newlines and
+// printable ASCII characters is replaced with an underscore.  See Policy for
+// a configurable alternative.
 func Sanitize[T []byte | string](s T) T {
-	var input []byte
-
-	if value, ok := any(s).([]byte); ok {
-		input = value
-	} else {
-		input = []byte(s)
-	}
-
-	for i, b := range input {
-		if b != 0xa && (b < 0x20 || b > 0x7e) {
-			input[i] = '_'
-		}
-	}
-
-	return T(input)
+	// The default policy replaces characters instead of rejecting them,
+	// so it never fails.
+	out, _, _ := DefaultPolicy.sanitize([]byte(s), true)
+	return T(out)
 }
 
 func SplitLines(s string) []string {